@@ -2,6 +2,7 @@ package isy
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -9,21 +10,45 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-
-	"github.com/davecgh/go-spew/spew"
+	"strings"
+	"time"
 )
 
 var servicePath *url.URL
 
+// DefaultServiceURN is the SOAP service used when ClientConfig.ServiceURN
+// is not set.
+const DefaultServiceURN = "urn:udi-com:service:X_Insteon_Lighting_Service:1"
+
+// DefaultUserAgent is the User-Agent header sent when ClientConfig.UserAgent
+// is not set.
+const DefaultUserAgent = "go-isy"
+
+// defaultTimeout is the timeout for the HTTP client used when
+// ClientConfig.HTTPClient is not set.
+const defaultTimeout = 30 * time.Second
+
+// CredentialsFunc returns the username and password to use for a request to
+// the ISY.
+type CredentialsFunc func() (username, password string, err error)
+
 // Client represents a connection to a particular ISY.
 type Client struct {
 	*client
 }
 
 type client struct {
-	ServiceURL string
-	Username   string
-	Password   string
+	BaseURL     *url.URL
+	ServiceURL  string
+	ServiceURN  string
+	Username    string
+	Password    string
+	Credentials CredentialsFunc
+	HTTPClient  *http.Client
+	UserAgent   string
+	Headers     http.Header
+	PreferJSON  bool
+	SOAPVersion SOAPVersion
 }
 
 // ClientConfig is used to instantiate a client using NewClient.
@@ -31,6 +56,41 @@ type ClientConfig struct {
 	BaseURL  string
 	Username string
 	Password string
+
+	// Credentials, if set, is called to obtain the username and password
+	// for each request, instead of using Username and Password. This
+	// allows credentials to be fetched from a secret store as needed,
+	// rather than being held in memory for the lifetime of the client.
+	Credentials CredentialsFunc
+
+	// ServiceURN is the SOAP service namespace that requests are sent to.
+	// If empty, DefaultServiceURN is used.
+	ServiceURN string
+
+	// HTTPClient is the client used to make requests to the ISY. If nil,
+	// a client with a default timeout is used. A client with a custom
+	// Transport can be used to intercept requests, such as in tests.
+	HTTPClient *http.Client
+
+	// UserAgent is sent as the User-Agent header of every request. If
+	// empty, DefaultUserAgent is used.
+	UserAgent string
+
+	// Headers are added to every request, such as for the benefit of a
+	// proxy between the client and the ISY. They cannot override the
+	// headers that the ISY protocol itself requires.
+	Headers http.Header
+
+	// PreferJSON asks the ISY to respond with JSON rather than XML for the
+	// REST API requests that support it, such as GetNodes, GetStatus and
+	// RunProgram. Firmware that does not support JSON ignores the request
+	// and responds with XML as usual, so either is accepted.
+	PreferJSON bool
+
+	// SOAPVersion is the version of SOAP used for requests to the service
+	// given in ServiceURN. The zero value is SOAP12, which the ISY's main
+	// service expects, but some other services accept only SOAP11.
+	SOAPVersion SOAPVersion
 }
 
 // NewClient creates a new client with the given configuration.
@@ -41,40 +101,66 @@ func NewClient(config *ClientConfig) (Client, error) {
 	}
 	serviceURLObj := urlObj.ResolveReference(servicePath)
 
+	serviceURN := config.ServiceURN
+	if serviceURN == "" {
+		serviceURN = DefaultServiceURN
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout: defaultTimeout,
+		}
+	}
+
+	switch config.SOAPVersion {
+	case SOAP12, SOAP11:
+	default:
+		return Client{}, fmt.Errorf("unsupported %s", config.SOAPVersion)
+	}
+
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
 	return Client{
 		&client{
-			ServiceURL: serviceURLObj.String(),
-			Username:   config.Username,
-			Password:   config.Password,
+			BaseURL:     urlObj,
+			ServiceURL:  serviceURLObj.String(),
+			ServiceURN:  serviceURN,
+			Username:    config.Username,
+			Password:    config.Password,
+			Credentials: config.Credentials,
+			HTTPClient:  httpClient,
+			UserAgent:   userAgent,
+			Headers:     config.Headers.Clone(),
+			PreferJSON:  config.PreferJSON,
+			SOAPVersion: config.SOAPVersion,
 		},
 	}, nil
 }
 
 func (c *client) GetAllFunctions() ([]*Function, error) {
-	body, err := c.request(getAllD2DReq{})
+	return c.GetAllFunctionsContext(context.Background())
+}
+
+// GetAllFunctionsContext is like GetAllFunctions but allows the request to
+// be cancelled or bounded by the given context.
+func (c *client) GetAllFunctionsContext(ctx context.Context) ([]*Function, error) {
+	body, err := c.request(ctx, getAllD2DReq{})
 	if err != nil {
 		return nil, err
 	}
 
-	dec := xml.NewDecoder(bytes.NewReader(body))
-	var start *xml.StartElement
-	for {
-		tok, err := dec.Token()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, err
-		}
+	return decodeFunctions(body)
+}
 
-		if open, isOpen := tok.(xml.StartElement); isOpen {
-			if open.Name.Local == "triggers" {
-				start = &open
-				break
-			}
-		}
+func decodeFunctions(body []byte) ([]*Function, error) {
+	dec, start, err := findSOAPElement(body, xml.Name{Local: "triggers"})
+	if err != nil {
+		return nil, err
 	}
-
 	if start == nil {
 		return nil, errors.New("'triggers' element not found in response")
 	}
@@ -85,52 +171,207 @@ func (c *client) GetAllFunctions() ([]*Function, error) {
 		return nil, err
 	}
 
-	spew.Dump(raw)
+	ret := make([]*Function, len(raw.D2Ds))
+	for i, d2d := range raw.D2Ds {
+		ret[i] = newFunctionFromRaw(&d2d.Trigger)
+	}
 
-	return nil, nil
+	return ret, nil
 }
 
-func (c *client) request(obj interface{}) ([]byte, error) {
-	req, err := c.formatRequest(obj)
+func (c *client) request(ctx context.Context, obj interface{}) ([]byte, error) {
+	req, err := c.formatRequest(ctx, obj)
 	if err != nil {
 		return nil, err
 	}
 
-	httpC := &http.Client{}
-	resp, err := httpC.Do(req)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ISY may return a fault either with an error status or, for
+	// SOAP 1.1-style responses, with a 200 OK status.
+	fault, err := decodeSOAPFault(body)
+	if err != nil && resp.StatusCode == 200 {
+		return nil, err
+	}
+	if fault != nil {
+		return nil, fault
+	}
+
 	if resp.StatusCode != 200 {
-		return nil, errors.New(resp.Status)
+		return nil, newHTTPError(resp, body)
+	}
+
+	return body, nil
+}
+
+// restRequest makes a GET request to the given path of the ISY's REST API,
+// relative to the base URL, and returns the response body.
+func (c *client) restRequest(ctx context.Context, path string) ([]byte, error) {
+	return c.restDo(ctx, "GET", path, "", "", nil)
+}
+
+// restRequestData is like restRequest but asks for a JSON response if the
+// client is configured to prefer JSON. The caller must be prepared to
+// decode either JSON or XML.
+func (c *client) restRequestData(ctx context.Context, path string) ([]byte, error) {
+	accept := ""
+	if c.PreferJSON {
+		accept = "application/json, text/xml;q=0.9"
 	}
+	return c.restDo(ctx, "GET", path, accept, "", nil)
+}
+
+// restPost is like restRequest but makes a POST request with the given body.
+func (c *client) restPost(ctx context.Context, path string, contentType string, body io.Reader) ([]byte, error) {
+	return c.restDo(ctx, "POST", path, "", contentType, body)
+}
+
+func (c *client) restDo(ctx context.Context, method, path string, accept, contentType string, reqBody io.Reader) ([]byte, error) {
+	relURL, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u := c.BaseURL.ResolveReference(relURL)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(req.Header)
+	err = c.setAuth(req)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, newHTTPError(resp, body)
+	}
 
 	return body, nil
 }
 
-func (c *client) formatRequest(obj interface{}) (*http.Request, error) {
-	msg, err := makeSOAPMessage(obj)
+// isJSON returns true if the given response body appears to be JSON rather
+// than XML.
+func isJSON(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	return len(body) > 0 && (body[0] == '{' || body[0] == '[')
+}
+
+// maxErrorBodyLen is the maximum number of bytes of a response body that
+// will be retained in an HTTPError.
+const maxErrorBodyLen = 1024
+
+// HTTPError is the error type returned when the ISY responds with an
+// unsuccessful HTTP status.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+
+	// Body is the body of the response, truncated to a reasonable length.
+	Body string
+}
+
+// NewHTTPError returns an HTTPError describing the given unsuccessful
+// response, reading at most the first 1024 bytes of its body. The caller
+// remains responsible for closing the body.
+func NewHTTPError(resp *http.Response) *HTTPError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen))
+	return newHTTPError(resp, body)
+}
+
+func newHTTPError(resp *http.Response, body []byte) *HTTPError {
+	if len(body) > maxErrorBodyLen {
+		body = body[:maxErrorBodyLen]
+	}
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+}
+
+func (e *HTTPError) Error() string {
+	body := strings.TrimSpace(e.Body)
+	if body == "" {
+		return e.Status
+	}
+	return fmt.Sprintf("%s: %s", e.Status, body)
+}
+
+func (c *client) formatRequest(ctx context.Context, obj interface{}) (*http.Request, error) {
+	msg, err := makeSOAPMessage(c.SOAPVersion, c.ServiceURN, obj)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("POST", c.ServiceURL, bytes.NewReader(msg.Body))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.ServiceURL, bytes.NewReader(msg.Body))
 	if err != nil {
 		return nil, err
 	}
+	c.setHeaders(req.Header)
 	req.Header.Set("Content-Type", "text/xml; charset=\"utf-8\"")
 	req.ContentLength = int64(len(msg.Body))
-	req.SetBasicAuth(c.Username, c.Password)
-	req.Header.Set("SOAPACTION", msg.Action)
-	req.Header.Set("User-Agent", "go-isy")
+	err = c.setAuth(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("SOAPACTION", c.SOAPVersion.actionHeader(msg.Action))
 	return req, nil
 }
 
+// setAuth sets the credentials for the given request, calling the
+// configured CredentialsFunc if there is one.
+func (c *client) setAuth(req *http.Request) error {
+	username, password := c.Username, c.Password
+	if c.Credentials != nil {
+		var err error
+		username, password, err = c.Credentials()
+		if err != nil {
+			return fmt.Errorf("failed to obtain ISY credentials: %s", err)
+		}
+	}
+	req.SetBasicAuth(username, password)
+	return nil
+}
+
+// setHeaders adds the configured custom headers and User-Agent to the
+// given header set.
+func (c *client) setHeaders(h http.Header) {
+	for k, vs := range c.Headers {
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	h.Set("User-Agent", c.UserAgent)
+}
+
 type getAllD2DReq struct {
-	XMLName string `xml:"urn:udi-com:service:X_Insteon_Lighting_Service:1 GetAllD2D"`
+	XMLName string `xml:"GetAllD2D"`
 }
 
 func init() {
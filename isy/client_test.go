@@ -2,10 +2,16 @@ package isy
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/andreyvit/diff"
+	"github.com/davecgh/go-spew/spew"
 )
 
 func TestClientFormatRequest(t *testing.T) {
@@ -18,7 +24,7 @@ func TestClientFormatRequest(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	req, err := client.formatRequest(&testSOAPMessage{})
+	req, err := client.formatRequest(context.Background(), &testSOAPMessage{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -47,3 +53,286 @@ Soapaction: urn:udi-com:service:X_Insteon_Lighting_Service:1#TestMessage
 		t.Errorf("wrong result\n%s", diff.LineDiff(want, got))
 	}
 }
+
+func TestClientFormatRequestSOAP11(t *testing.T) {
+	client, err := NewClient(&ClientConfig{
+		BaseURL:     "http://127.0.0.1/",
+		Username:    "test",
+		Password:    "test",
+		SOAPVersion: SOAP11,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := client.formatRequest(context.Background(), &testSOAPMessage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	req.Write(buf)
+
+	got := strings.Replace(strings.TrimSpace(buf.String()), "\r", "", -1)
+	want := strings.TrimSpace(`
+POST /services HTTP/1.1
+Host: 127.0.0.1
+User-Agent: go-isy
+Content-Length: 230
+Authorization: Basic dGVzdDp0ZXN0
+Content-Type: text/xml; charset="utf-8"
+Soapaction: "urn:udi-com:service:X_Insteon_Lighting_Service:1#TestMessage"
+
+<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <TestMessage xmlns="urn:udi-com:service:X_Insteon_Lighting_Service:1"></TestMessage>
+  </Body>
+</Envelope>
+`)
+
+	if got != want {
+		t.Errorf("wrong result\n%s", diff.LineDiff(want, got))
+	}
+}
+
+func TestNewClientUnsupportedSOAPVersion(t *testing.T) {
+	_, err := NewClient(&ClientConfig{
+		BaseURL:     "http://127.0.0.1/",
+		SOAPVersion: SOAPVersion(5),
+	})
+	if err == nil || err.Error() != "unsupported SOAPVersion(5)" {
+		t.Errorf("wrong error %v", err)
+	}
+}
+
+// testTransport is an http.RoundTripper that passes each request to a
+// function rather than sending it over the network.
+type testTransport func(req *http.Request) (*http.Response, error)
+
+func (t testTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t(req)
+}
+
+func testClient(t *testing.T, status int, body string) (Client, *[]*http.Request) {
+	var reqs []*http.Request
+	client, err := NewClient(&ClientConfig{
+		BaseURL:  "http://127.0.0.1/",
+		Username: "test",
+		Password: "test",
+		HTTPClient: &http.Client{
+			Transport: testTransport(func(req *http.Request) (*http.Response, error) {
+				reqs = append(reqs, req)
+				return &http.Response{
+					StatusCode: status,
+					Status:     http.StatusText(status),
+					Header:     http.Header{"Content-Type": {"text/xml"}},
+					Body:       ioutil.NopCloser(strings.NewReader(body)),
+					Request:    req,
+				}, nil
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &reqs
+}
+
+func TestClientGetAllFunctions(t *testing.T) {
+	client, reqs := testClient(t, 200, `
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+  <s:Body>
+    <triggers>
+      <d2d><trigger><id>1</id><name>My Programs</name><folder/></trigger></d2d>
+      <d2d><trigger><id>2</id><name>Porch Light</name><parent>1</parent></trigger></d2d>
+    </triggers>
+  </s:Body>
+</s:Envelope>
+`)
+
+	got, err := client.GetAllFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Function{
+		{ID: 1, Name: "My Programs", IsFolder: true},
+		{ID: 2, Name: "Porch Light", ParentID: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	if len(*reqs) != 1 {
+		t.Fatalf("made %d requests; want 1", len(*reqs))
+	}
+	req := (*reqs)[0]
+	if got, want := req.URL.String(), "http://127.0.0.1/services"; got != want {
+		t.Errorf("wrong URL %q; want %q", got, want)
+	}
+	if got, want := req.Header.Get("SOAPACTION"), DefaultServiceURN+"#GetAllD2D"; got != want {
+		t.Errorf("wrong SOAPACTION %q; want %q", got, want)
+	}
+}
+
+func TestClientGetAllFunctionsErrors(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Status int
+		Body   string
+		Want   string
+	}{
+		{
+			"no triggers",
+			200,
+			`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><Foo/></s:Body></s:Envelope>`,
+			"'triggers' element not found in response",
+		},
+		{
+			"fault",
+			500,
+			`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><s:Fault><s:Code><s:Value>s:Sender</s:Value></s:Code><s:Reason><s:Text>Bad request</s:Text></s:Reason></s:Fault></s:Body></s:Envelope>`,
+			"SOAP fault s:Sender: Bad request",
+		},
+		{
+			"HTTP error",
+			401,
+			`Unauthorized`,
+			"Unauthorized: Unauthorized",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			client, _ := testClient(t, test.Status, test.Body)
+			_, err := client.GetAllFunctions()
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if got := err.Error(); got != test.Want {
+				t.Errorf("wrong error %q; want %q", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPError(t *testing.T) {
+	tests := []struct {
+		Name string
+		Body string
+		Want string
+	}{
+		{"short", "no such node", "no such node"},
+		{"truncated", strings.Repeat("x", 1000) + strings.Repeat("y", 100), strings.Repeat("x", 1000) + strings.Repeat("y", 24)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			got := NewHTTPError(&http.Response{
+				StatusCode: 404,
+				Status:     "404 Not Found",
+				Body:       ioutil.NopCloser(strings.NewReader(test.Body)),
+			})
+			want := &HTTPError{
+				StatusCode: 404,
+				Status:     "404 Not Found",
+				Body:       test.Want,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestClientCustomHeaders(t *testing.T) {
+	client, err := NewClient(&ClientConfig{
+		BaseURL:   "http://127.0.0.1/",
+		Username:  "test",
+		Password:  "test",
+		UserAgent: "my-app/1.0",
+		Headers: http.Header{
+			"X-Gateway-Token": {"abc123"},
+			"Soapaction":      {"ignored"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := client.formatRequest(context.Background(), &testSOAPMessage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := http.Header{
+		"User-Agent":      {"my-app/1.0"},
+		"X-Gateway-Token": {"abc123"},
+		"Authorization":   {"Basic dGVzdDp0ZXN0"},
+		"Content-Type":    {`text/xml; charset="utf-8"`},
+		"Soapaction":      {"urn:udi-com:service:X_Insteon_Lighting_Service:1#TestMessage"},
+	}
+	if !reflect.DeepEqual(req.Header, want) {
+		t.Errorf("wrong headers\ngot:  %s\nwant: %s", spew.Sdump(req.Header), spew.Sdump(want))
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	calls := 0
+	client, err := NewClient(&ClientConfig{
+		BaseURL:  "http://127.0.0.1/",
+		Username: "ignored",
+		Password: "ignored",
+		Credentials: func() (string, string, error) {
+			calls++
+			if calls > 1 {
+				return "", "", errors.New("vault unavailable")
+			}
+			return "test", "test", nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := client.formatRequest(context.Background(), &testSOAPMessage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := req.Header.Get("Authorization"), "Basic dGVzdDp0ZXN0"; got != want {
+		t.Errorf("wrong Authorization %q; want %q", got, want)
+	}
+
+	_, err = client.formatRequest(context.Background(), &testSOAPMessage{})
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if got, want := err.Error(), "failed to obtain ISY credentials: vault unavailable"; got != want {
+		t.Errorf("wrong error %q; want %q", got, want)
+	}
+}
+
+func TestClientPreferJSON(t *testing.T) {
+	client, reqs := testClient(t, 200, `{"nodes":[]}`)
+	client.PreferJSON = true
+
+	_, err := client.GetNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := (*reqs)[0].Header.Get("Accept"), "application/json, text/xml;q=0.9"; got != want {
+		t.Errorf("wrong Accept header %q; want %q", got, want)
+	}
+}
+
+func TestClientGetNode(t *testing.T) {
+	client, reqs := testClient(t, 404, `Not Found`)
+
+	_, err := client.GetNode("1A 2B 3C 1")
+	if err != ErrNodeNotFound {
+		t.Errorf("wrong error %v; want %v", err, ErrNodeNotFound)
+	}
+	if got, want := (*reqs)[0].URL.String(), "http://127.0.0.1/rest/nodes/1A%202B%203C%201"; got != want {
+		t.Errorf("wrong URL %q; want %q", got, want)
+	}
+}
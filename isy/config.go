@@ -0,0 +1,115 @@
+package isy
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SystemConfig describes an ISY and the firmware it is running.
+type SystemConfig struct {
+	// Name and UUID identify this particular ISY.
+	Name string
+	UUID string
+
+	// Model is a description of the hardware, such as "ISY 994i Series".
+	Model    string
+	Platform string
+
+	// App and Version identify the firmware, such as "Insteon_UD994" and
+	// "5.0.16".
+	App     string
+	Version string
+}
+
+type systemConfigRaw struct {
+	App      string `xml:"app"`
+	Version  string `xml:"app_version"`
+	Platform string `xml:"platform"`
+	Model    string `xml:"deviceSpecs>model"`
+	UUID     string `xml:"root>id"`
+	Name     string `xml:"root>name"`
+}
+
+// minNodeServerVersion is the first firmware version to support node
+// servers.
+var minNodeServerVersion = []int{5, 0, 0}
+
+// GetConfig returns information about the ISY and its firmware.
+func (c *client) GetConfig() (*SystemConfig, error) {
+	return c.GetConfigContext(context.Background())
+}
+
+// GetConfigContext is like GetConfig but allows the request to be cancelled
+// or bounded by the given context.
+func (c *client) GetConfigContext(ctx context.Context) (*SystemConfig, error) {
+	body, err := c.restRequest(ctx, "./rest/config")
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSystemConfig(body)
+}
+
+func decodeSystemConfig(body []byte) (*SystemConfig, error) {
+	var raw systemConfigRaw
+	err := xml.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response from ISY: %s", err)
+	}
+
+	return &SystemConfig{
+		Name:     raw.Name,
+		UUID:     raw.UUID,
+		Model:    raw.Model,
+		Platform: raw.Platform,
+		App:      raw.App,
+		Version:  raw.Version,
+	}, nil
+}
+
+// SupportsNodeServers returns true if the ISY's firmware is new enough to
+// support node servers, which requires version 5.0.0 or later.
+func (c *SystemConfig) SupportsNodeServers() bool {
+	return compareVersions(parseVersion(c.Version), minNodeServerVersion) >= 0
+}
+
+// parseVersion parses a dotted version string into its numeric parts,
+// ignoring any non-numeric suffix such as in "5.0.0_beta". Parsing stops at
+// the first part that doesn't start with a digit.
+func parseVersion(s string) []int {
+	var ret []int
+	for _, part := range strings.Split(strings.TrimSpace(s), ".") {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		n, err := strconv.Atoi(part[:end])
+		if err != nil {
+			break
+		}
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+// compareVersions returns a negative number, zero or a positive number
+// depending on whether a is less than, equal to or greater than b. Missing
+// trailing parts are treated as zero.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
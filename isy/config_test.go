@@ -0,0 +1,66 @@
+package isy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestDecodeSystemConfig(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<configuration>
+  <deviceSpecs>
+    <make>Universal Devices Inc.</make>
+    <model>ISY 994i Series</model>
+  </deviceSpecs>
+  <app>Insteon_UD994</app>
+  <app_version>5.0.16</app_version>
+  <platform>ISY-C-994</platform>
+  <root>
+    <id>00:21:b9:02:00:00</id>
+    <name>Home</name>
+  </root>
+</configuration>
+`)
+
+	got, err := decodeSystemConfig(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &SystemConfig{
+		Name:     "Home",
+		UUID:     "00:21:b9:02:00:00",
+		Model:    "ISY 994i Series",
+		Platform: "ISY-C-994",
+		App:      "Insteon_UD994",
+		Version:  "5.0.16",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestSystemConfigSupportsNodeServers(t *testing.T) {
+	tests := []struct {
+		Version string
+		Want    bool
+	}{
+		{"5.0.16", true},
+		{"5.0.0", true},
+		{"5", true},
+		{"5.0.0_beta", true},
+		{"10.1", true},
+		{"4.7.3", false},
+		{"4.99", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		c := &SystemConfig{Version: test.Version}
+		if got := c.SupportsNodeServers(); got != test.Want {
+			t.Errorf("wrong result for %q: got %t, want %t", test.Version, got, test.Want)
+		}
+	}
+}
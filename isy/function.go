@@ -2,13 +2,113 @@ package isy
 
 import (
 	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
+// Function represents a program (or a folder of programs) defined on the ISY.
 type Function struct {
+	ID       int
+	Name     string
+	ParentID int
+	IsFolder bool
+	Comment  string
+
+	// Then and Else are the actions taken when the program's conditions
+	// are true and false respectively.
+	Then []Action
+	Else []Action
+}
+
+func newFunctionFromRaw(raw *triggerRaw) *Function {
+	return &Function{
+		ID:       raw.ID,
+		Name:     raw.Name,
+		ParentID: raw.ParentID,
+		IsFolder: bool(raw.IsFolder),
+		Comment:  raw.Comment,
+		Then:     raw.Then.Actions,
+		Else:     raw.Else.Actions,
+	}
+}
+
+// ProgramNode is a node in the tree of programs and folders produced by
+// BuildProgramTree.
+type ProgramNode struct {
+	*Function
+	Children []*ProgramNode
+}
+
+// BuildProgramTree arranges the given functions into a tree according to
+// their ParentID, returning the roots. A function whose parent is not
+// among those given is considered to be a root.
+//
+// Children appear in the same relative order as in the given slice.
+func BuildProgramTree(fns []*Function) []*ProgramNode {
+	nodes := make(map[int]*ProgramNode, len(fns))
+	for _, fn := range fns {
+		nodes[fn.ID] = &ProgramNode{Function: fn}
+	}
+
+	var roots []*ProgramNode
+	for _, fn := range fns {
+		node := nodes[fn.ID]
+		parent, hasParent := nodes[fn.ParentID]
+		if !hasParent || parent == node {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	return roots
 }
 
+// Action is implemented by the types representing the individual steps in
+// a program's action sequences: *SetPropertyAction, *RunProgramAction,
+// *WaitAction, *SendNotificationAction, and *UnknownAction.
 type Action interface{}
 
+// SetPropertyAction sets a property ("driver") of a node, or sends it a
+// command.
+type SetPropertyAction struct {
+	Node    string `xml:"node"`
+	Control string `xml:"control"`
+	Value   string `xml:"value"`
+	UOM     UOM    `xml:"uom"`
+}
+
+// RunProgramAction runs, stops, enables or disables another program.
+type RunProgramAction struct {
+	ProgramID int `xml:"id"`
+
+	// Branch is the program command to apply, such as "run", "runThen",
+	// "runElse" or "stop".
+	Branch string `xml:"branch"`
+}
+
+// WaitAction pauses the action sequence.
+type WaitAction struct {
+	Seconds int
+
+	// Random is true if the wait is for a random duration of up to
+	// Seconds.
+	Random bool
+}
+
+// SendNotificationAction sends a notification to a configured recipient.
+type SendNotificationAction struct {
+	To      string `xml:"to"`
+	Content string `xml:"content"`
+}
+
+// UnknownAction represents an action of a type not otherwise supported by
+// this package, retaining its raw XML.
+type UnknownAction struct {
+	Name     string
+	InnerXML string
+}
+
 type triggersRaw struct {
 	D2Ds []d2dRaw `xml:"d2d"`
 }
@@ -32,12 +132,86 @@ type actionSeq struct {
 	Actions []Action
 }
 
+type waitActionRaw struct {
+	Seconds int     `xml:"seconds"`
+	Random  setBool `xml:"random"`
+}
+
+func (s *actionSeq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			action, err := decodeAction(d, tok)
+			if err != nil {
+				return err
+			}
+			s.Actions = append(s.Actions, action)
+		}
+	}
+}
+
+func decodeAction(d *xml.Decoder, start xml.StartElement) (Action, error) {
+	switch start.Name.Local {
+	case "setProperty":
+		action := &SetPropertyAction{}
+		err := d.DecodeElement(action, &start)
+		return action, err
+	case "runProgram":
+		action := &RunProgramAction{}
+		err := d.DecodeElement(action, &start)
+		return action, err
+	case "wait":
+		var raw waitActionRaw
+		err := d.DecodeElement(&raw, &start)
+		return &WaitAction{
+			Seconds: raw.Seconds,
+			Random:  bool(raw.Random),
+		}, err
+	case "sendNotification":
+		action := &SendNotificationAction{}
+		err := d.DecodeElement(action, &start)
+		return action, err
+	default:
+		var raw soapInnerXML
+		err := d.DecodeElement(&raw, &start)
+		return &UnknownAction{
+			Name:     start.Name.Local,
+			InnerXML: raw.Content,
+		}, err
+	}
+}
+
 type conditions interface{}
 
+// setBool is a boolean represented by the presence of an element, which
+// may optionally contain an explicit value such as "false" or "0".
 type setBool bool
 
 func (b *setBool) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	// If the element is present at all then we're true
-	*b = true
-	return d.Skip()
+	var text string
+	err := d.DecodeElement(&text, &start)
+	if err != nil {
+		return err
+	}
+
+	// If the element is present but empty then we're true
+	text = strings.TrimSpace(text)
+	if text == "" {
+		*b = true
+		return nil
+	}
+
+	v, err := strconv.ParseBool(text)
+	if err != nil {
+		return fmt.Errorf("invalid boolean value %q for %s", text, start.Name.Local)
+	}
+	*b = setBool(v)
+	return nil
 }
@@ -0,0 +1,196 @@
+package isy
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestDecodeFunctions(t *testing.T) {
+	body := []byte(`
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+  <s:Body>
+    <GetAllD2DResponse>
+      <triggers>
+        <d2d>
+          <trigger>
+            <id>1</id>
+            <name>My Programs</name>
+            <parent>0</parent>
+            <folder/>
+          </trigger>
+        </d2d>
+        <d2d>
+          <trigger>
+            <id>2</id>
+            <name>Porch Light</name>
+            <parent>1</parent>
+            <comment>Turns on at sunset</comment>
+            <then>
+              <setProperty><node>1A 2B 3C 1</node><control>DON</control><value>255</value><uom>100</uom></setProperty>
+              <wait><seconds>30</seconds><random/></wait>
+              <runProgram><id>3</id><branch>runThen</branch></runProgram>
+            </then>
+            <else>
+              <sendNotification><to>1</to><content>Porch</content></sendNotification>
+              <somethingElse><foo>bar</foo></somethingElse>
+            </else>
+          </trigger>
+        </d2d>
+      </triggers>
+    </GetAllD2DResponse>
+  </s:Body>
+</s:Envelope>
+`)
+
+	got, err := decodeFunctions(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Function{
+		{
+			ID:       1,
+			Name:     "My Programs",
+			ParentID: 0,
+			IsFolder: true,
+		},
+		{
+			ID:       2,
+			Name:     "Porch Light",
+			ParentID: 1,
+			Comment:  "Turns on at sunset",
+			Then: []Action{
+				&SetPropertyAction{
+					Node:    "1A 2B 3C 1",
+					Control: "DON",
+					Value:   "255",
+					UOM:     UOMByteLevel,
+				},
+				&WaitAction{
+					Seconds: 30,
+					Random:  true,
+				},
+				&RunProgramAction{
+					ProgramID: 3,
+					Branch:    "runThen",
+				},
+			},
+			Else: []Action{
+				&SendNotificationAction{
+					To:      "1",
+					Content: "Porch",
+				},
+				&UnknownAction{
+					Name:     "somethingElse",
+					InnerXML: "<foo>bar</foo>",
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestDecodeFunctionsNamespaced(t *testing.T) {
+	body := []byte(`
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Header>
+    <triggers><d2d><trigger><id>99</id></trigger></d2d></triggers>
+  </s:Header>
+  <s:Body>
+    <u:GetAllD2DResponse xmlns:u="urn:udi-com:service:X_Insteon_Lighting_Service:1">
+      <u:triggers>
+        <u:d2d>
+          <u:trigger>
+            <u:id>1</u:id>
+            <u:name>Porch Light</u:name>
+            <u:parent>0</u:parent>
+          </u:trigger>
+        </u:d2d>
+      </u:triggers>
+    </u:GetAllD2DResponse>
+  </s:Body>
+</s:Envelope>
+`)
+
+	got, err := decodeFunctions(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Function{
+		{
+			ID:   1,
+			Name: "Porch Light",
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestSetBool(t *testing.T) {
+	tests := []struct {
+		XML     string
+		Want    bool
+		WantErr bool
+	}{
+		{`<doc></doc>`, false, false},
+		{`<doc><folder/></doc>`, true, false},
+		{`<doc><folder> </folder></doc>`, true, false},
+		{`<doc><folder>true</folder></doc>`, true, false},
+		{`<doc><folder>1</folder></doc>`, true, false},
+		{`<doc><folder>false</folder></doc>`, false, false},
+		{`<doc><folder>0</folder></doc>`, false, false},
+		{`<doc><folder>maybe</folder></doc>`, false, true},
+	}
+
+	for _, test := range tests {
+		var doc struct {
+			Folder setBool `xml:"folder"`
+		}
+		err := xml.Unmarshal([]byte(test.XML), &doc)
+		if (err != nil) != test.WantErr {
+			t.Errorf("wrong error for %s\ngot error: %v\nwant error: %t", test.XML, err, test.WantErr)
+			continue
+		}
+		if got := bool(doc.Folder); got != test.Want {
+			t.Errorf("wrong result for %s: got %t, want %t", test.XML, got, test.Want)
+		}
+	}
+}
+
+func TestBuildProgramTree(t *testing.T) {
+	root := &Function{ID: 1, Name: "My Programs", IsFolder: true}
+	folder := &Function{ID: 2, Name: "Lights", ParentID: 1, IsFolder: true}
+	porch := &Function{ID: 3, Name: "Porch", ParentID: 2}
+	hall := &Function{ID: 4, Name: "Hall", ParentID: 2}
+	orphan := &Function{ID: 5, Name: "Orphan", ParentID: 99}
+
+	got := BuildProgramTree([]*Function{porch, root, hall, folder, orphan})
+	want := []*ProgramNode{
+		{
+			Function: root,
+			Children: []*ProgramNode{
+				{
+					Function: folder,
+					Children: []*ProgramNode{
+						{Function: porch},
+						{Function: hall},
+					},
+				},
+			},
+		},
+		{Function: orphan},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
@@ -0,0 +1,393 @@
+package isy
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ErrNodeNotFound is returned by GetNode if the ISY has no node with the
+// given address.
+var ErrNodeNotFound = errors.New("node not found")
+
+// Node represents a node defined on the ISY.
+type Node struct {
+	Address string
+	Name    string
+
+	// Type is the ISY's device type identifier, such as "1.32.65.0".
+	Type string
+
+	// NodeDefID is the id of the node definition, for nodes that have one.
+	NodeDefID string
+
+	// Parent is the address of the node's parent node or folder, if any.
+	Parent string
+
+	// PrimaryNode is the address of the primary node of the group this
+	// node belongs to, which may be the node itself.
+	PrimaryNode string
+
+	Enabled bool
+
+	// Properties are the current values of the node's properties. They
+	// are populated only by GetNode.
+	Properties []Property
+}
+
+type nodesRaw struct {
+	Nodes []nodeRaw `xml:"node"`
+}
+
+type nodeRaw struct {
+	NodeDefID   string `xml:"nodeDefId,attr"`
+	Address     string `xml:"address"`
+	Name        string `xml:"name"`
+	Type        string `xml:"type"`
+	Parent      string `xml:"parent"`
+	PrimaryNode string `xml:"pnode"`
+	Enabled     bool   `xml:"enabled"`
+}
+
+// nodesJSON is the JSON equivalent of nodesRaw, returned by firmware that
+// supports JSON responses.
+type nodesJSON struct {
+	Nodes []nodeJSON `json:"nodes"`
+}
+
+type nodeJSON struct {
+	NodeDefID   string `json:"nodeDefId"`
+	Address     string `json:"address"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Parent      string `json:"parent"`
+	PrimaryNode string `json:"pnode"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// GetNodes returns all of the nodes currently defined on the ISY.
+func (c *client) GetNodes() ([]*Node, error) {
+	return c.GetNodesContext(context.Background())
+}
+
+// GetNodesContext is like GetNodes but allows the request to be cancelled
+// or bounded by the given context.
+func (c *client) GetNodesContext(ctx context.Context) ([]*Node, error) {
+	body, err := c.restRequestData(ctx, "./rest/nodes")
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeNodes(body)
+}
+
+func decodeNodes(body []byte) ([]*Node, error) {
+	if isJSON(body) {
+		return decodeNodesJSON(body)
+	}
+
+	var raw nodesRaw
+	err := xml.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*Node, len(raw.Nodes))
+	for i, n := range raw.Nodes {
+		ret[i] = newNodeFromRaw(&n)
+	}
+
+	return ret, nil
+}
+
+func decodeNodesJSON(body []byte) ([]*Node, error) {
+	var raw nodesJSON
+	err := json.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*Node, len(raw.Nodes))
+	for i, n := range raw.Nodes {
+		ret[i] = newNodeFromRaw((*nodeRaw)(&n))
+	}
+
+	return ret, nil
+}
+
+// GetNode returns the node with the given address, such as to find the
+// node definition the ISY currently has for it. If there is no such node
+// then the error is ErrNodeNotFound.
+func (c *client) GetNode(addr string) (*Node, error) {
+	return c.GetNodeContext(context.Background(), addr)
+}
+
+// GetNodeContext is like GetNode but allows the request to be cancelled or
+// bounded by the given context.
+func (c *client) GetNodeContext(ctx context.Context, addr string) (*Node, error) {
+	body, err := c.restRequestData(ctx, "./rest/nodes/"+url.PathEscape(addr))
+	if err, ok := err.(*HTTPError); ok && err.StatusCode == http.StatusNotFound {
+		return nil, ErrNodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeNodeInfo(body)
+}
+
+type nodeInfoRaw struct {
+	Node       *nodeRaw            `xml:"node"`
+	Properties []statusPropertyRaw `xml:"properties>property"`
+}
+
+type nodeInfoJSON struct {
+	Node       *nodeJSON            `json:"node"`
+	Properties []statusPropertyJSON `json:"properties"`
+}
+
+func decodeNodeInfo(body []byte) (*Node, error) {
+	var raw nodeInfoRaw
+	if isJSON(body) {
+		var j nodeInfoJSON
+		err := json.Unmarshal(body, &j)
+		if err != nil {
+			return nil, err
+		}
+		raw.Node = (*nodeRaw)(j.Node)
+		for _, p := range j.Properties {
+			raw.Properties = append(raw.Properties, p.raw())
+		}
+	} else {
+		err := xml.Unmarshal(body, &raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A response without a node, such as a RestResponse document
+	// reporting failure, means that there is no such node.
+	if raw.Node == nil || raw.Node.Address == "" {
+		return nil, ErrNodeNotFound
+	}
+	node := newNodeFromRaw(raw.Node)
+	for i := range raw.Properties {
+		node.Properties = append(node.Properties, newPropertyFromRaw(&raw.Properties[i]))
+	}
+	return node, nil
+}
+
+func newNodeFromRaw(raw *nodeRaw) *Node {
+	return &Node{
+		Address:     raw.Address,
+		Name:        raw.Name,
+		Type:        raw.Type,
+		NodeDefID:   raw.NodeDefID,
+		Parent:      raw.Parent,
+		PrimaryNode: raw.PrimaryNode,
+		Enabled:     raw.Enabled,
+	}
+}
+
+// NodeStatus is the current value of a single property ("driver") of a node,
+// as returned by GetStatus.
+type NodeStatus struct {
+	Address string
+
+	// Property is the property id, such as "ST" for the main status.
+	Property string
+
+	Value     string
+	Formatted string
+	UOM       UOM
+
+	// Precision is the number of decimal places implied in Value. See
+	// Property.Float.
+	Precision int
+}
+
+// Float returns the numeric value of the property, taking into account
+// its precision.
+func (s *NodeStatus) Float() (float64, error) {
+	return parsePropertyValue(s.Value, s.Precision)
+}
+
+// Property is the current value of a single property ("driver") of a node,
+// as returned by GetNode.
+type Property struct {
+	// ID is the property id, such as "ST" for the main status.
+	ID string
+
+	// Value is the raw value, which for numeric properties is an integer
+	// with Precision implied decimal places.
+	Value string
+
+	// Formatted is the ISY's human-readable rendering of the value,
+	// including any unit.
+	Formatted string
+
+	UOM       UOM
+	Precision int
+}
+
+// Float returns the numeric value of the property, taking into account its
+// precision. For example, a Value of "725" with a Precision of 1 is 72.5.
+func (p *Property) Float() (float64, error) {
+	return parsePropertyValue(p.Value, p.Precision)
+}
+
+func parsePropertyValue(value string, prec int) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid numeric value %q", value)
+	}
+	if prec > 0 {
+		v /= math.Pow10(prec)
+	}
+	return v, nil
+}
+
+type statusNodesRaw struct {
+	Nodes []statusNodeRaw `xml:"node"`
+}
+
+type statusNodeRaw struct {
+	ID         string              `xml:"id,attr"`
+	Properties []statusPropertyRaw `xml:"property"`
+}
+
+type statusPropertyRaw struct {
+	ID        string `xml:"id,attr"`
+	Value     string `xml:"value,attr"`
+	Formatted string `xml:"formatted,attr"`
+	UOM       string `xml:"uom,attr"`
+	Precision string `xml:"prec,attr"`
+}
+
+func newPropertyFromRaw(raw *statusPropertyRaw) Property {
+	// Some properties have a non-numeric or empty UOM or precision, which
+	// we treat as unknown and zero respectively.
+	uom, _ := strconv.Atoi(raw.UOM)
+	prec, _ := strconv.Atoi(raw.Precision)
+	return Property{
+		ID:        raw.ID,
+		Value:     raw.Value,
+		Formatted: raw.Formatted,
+		UOM:       UOM(uom),
+		Precision: prec,
+	}
+}
+
+// statusNodesJSON is the JSON equivalent of statusNodesRaw.
+type statusNodesJSON struct {
+	Nodes []statusNodeJSON `json:"nodes"`
+}
+
+type statusNodeJSON struct {
+	ID         string               `json:"id"`
+	Properties []statusPropertyJSON `json:"properties"`
+}
+
+type statusPropertyJSON struct {
+	ID        string     `json:"id"`
+	Value     jsonScalar `json:"value"`
+	Formatted string     `json:"formatted"`
+	UOM       jsonScalar `json:"uom"`
+	Precision jsonScalar `json:"prec"`
+}
+
+func (p *statusPropertyJSON) raw() statusPropertyRaw {
+	return statusPropertyRaw{
+		ID:        p.ID,
+		Value:     string(p.Value),
+		Formatted: p.Formatted,
+		UOM:       string(p.UOM),
+		Precision: string(p.Precision),
+	}
+}
+
+// jsonScalar accepts a JSON string, number or boolean, since the ISY is not
+// consistent about which it uses for property values and flags.
+type jsonScalar string
+
+func (s *jsonScalar) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		*s = jsonScalar(str)
+		return nil
+	}
+	var flag bool
+	if err := json.Unmarshal(b, &flag); err == nil {
+		*s = jsonScalar(strconv.FormatBool(flag))
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(b, &num); err != nil {
+		return fmt.Errorf("expected string, number or boolean, got %s", b)
+	}
+	*s = jsonScalar(num)
+	return nil
+}
+
+// GetStatus returns a snapshot of the current values of all properties of
+// all nodes on the ISY.
+func (c *client) GetStatus() ([]NodeStatus, error) {
+	return c.GetStatusContext(context.Background())
+}
+
+// GetStatusContext is like GetStatus but allows the request to be cancelled
+// or bounded by the given context.
+func (c *client) GetStatusContext(ctx context.Context) ([]NodeStatus, error) {
+	body, err := c.restRequestData(ctx, "./rest/status")
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeStatus(body)
+}
+
+func decodeStatus(body []byte) ([]NodeStatus, error) {
+	var raw statusNodesRaw
+	if isJSON(body) {
+		var j statusNodesJSON
+		err := json.Unmarshal(body, &j)
+		if err != nil {
+			return nil, err
+		}
+		raw.Nodes = make([]statusNodeRaw, len(j.Nodes))
+		for i, n := range j.Nodes {
+			raw.Nodes[i].ID = n.ID
+			for _, p := range n.Properties {
+				raw.Nodes[i].Properties = append(raw.Nodes[i].Properties, p.raw())
+			}
+		}
+	} else {
+		err := xml.Unmarshal(body, &raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ret []NodeStatus
+	for _, n := range raw.Nodes {
+		for i := range n.Properties {
+			p := newPropertyFromRaw(&n.Properties[i])
+			ret = append(ret, NodeStatus{
+				Address:   n.ID,
+				Property:  p.ID,
+				Value:     p.Value,
+				Formatted: p.Formatted,
+				UOM:       p.UOM,
+				Precision: p.Precision,
+			})
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,270 @@
+package isy
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestDecodeNodes(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<nodes>
+  <root>Home</root>
+  <folder flag="12">
+    <address>12345</address>
+    <name>Outside</name>
+  </folder>
+  <node flag="128" nodeDefId="thermostat">
+    <address>n001_tstat</address>
+    <name>Thermostat</name>
+    <family instance="1">10</family>
+    <parent type="3">12345</parent>
+    <type>1.1.0.0</type>
+    <enabled>true</enabled>
+    <deviceClass>0</deviceClass>
+    <wattage>0</wattage>
+    <dcPeriod>0</dcPeriod>
+    <startDelay>0</startDelay>
+    <endDelay>0</endDelay>
+    <pnode>n001_tstat</pnode>
+  </node>
+  <node flag="0" nodeDefId="humidity">
+    <address>n001_humid</address>
+    <name>Humidity Sensor</name>
+    <type>1.1.0.0</type>
+    <enabled>false</enabled>
+    <pnode>n001_tstat</pnode>
+  </node>
+</nodes>
+`)
+
+	got, err := decodeNodes(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Node{
+		{
+			Address:     "n001_tstat",
+			Name:        "Thermostat",
+			Type:        "1.1.0.0",
+			NodeDefID:   "thermostat",
+			Parent:      "12345",
+			PrimaryNode: "n001_tstat",
+			Enabled:     true,
+		},
+		{
+			Address:     "n001_humid",
+			Name:        "Humidity Sensor",
+			Type:        "1.1.0.0",
+			NodeDefID:   "humidity",
+			PrimaryNode: "n001_tstat",
+			Enabled:     false,
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestDecodeStatus(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<nodes>
+  <node id="1A 2B 3C 1">
+    <property id="ST" value="255" formatted="On" uom="100"/>
+    <property id="OL" value="255" formatted="100%" uom="100"/>
+  </node>
+  <node id="n001_tstat">
+    <property id="ST" value="68" formatted="68°F" uom="17"/>
+    <property id="CLIMD" value="" formatted=" " uom=""/>
+  </node>
+</nodes>
+`)
+
+	got, err := decodeStatus(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []NodeStatus{
+		{Address: "1A 2B 3C 1", Property: "ST", Value: "255", Formatted: "On", UOM: UOMByteLevel},
+		{Address: "1A 2B 3C 1", Property: "OL", Value: "255", Formatted: "100%", UOM: UOMByteLevel},
+		{Address: "n001_tstat", Property: "ST", Value: "68", Formatted: "68°F", UOM: UOMFahrenheit},
+		{Address: "n001_tstat", Property: "CLIMD", Value: "", Formatted: " ", UOM: UOMUnknown},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestDecodeNodesJSON(t *testing.T) {
+	body := []byte(`{
+  "nodes": [
+    {
+      "nodeDefId": "thermostat",
+      "address": "n001_tstat",
+      "name": "Thermostat",
+      "type": "1.1.0.0",
+      "parent": "12345",
+      "pnode": "n001_tstat",
+      "enabled": true
+    }
+  ]
+}`)
+
+	got, err := decodeNodes(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Node{
+		{
+			Address:     "n001_tstat",
+			Name:        "Thermostat",
+			Type:        "1.1.0.0",
+			NodeDefID:   "thermostat",
+			Parent:      "12345",
+			PrimaryNode: "n001_tstat",
+			Enabled:     true,
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestDecodeStatusJSON(t *testing.T) {
+	body := []byte(`{
+  "nodes": [
+    {
+      "id": "n001_tstat",
+      "properties": [
+        {"id": "ST", "value": 68, "formatted": "68°F", "uom": "17"},
+        {"id": "CLIMD", "value": "", "formatted": " ", "uom": ""}
+      ]
+    }
+  ]
+}`)
+
+	got, err := decodeStatus(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []NodeStatus{
+		{Address: "n001_tstat", Property: "ST", Value: "68", Formatted: "68°F", UOM: UOMFahrenheit},
+		{Address: "n001_tstat", Property: "CLIMD", Value: "", Formatted: " ", UOM: UOMUnknown},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestDecodeNodeInfo(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Body    string
+		Want    *Node
+		WantErr error
+	}{
+		{
+			"xml",
+			`<nodeInfo>
+  <node flag="128" nodeDefId="zone">
+    <address>n003_zone1</address>
+    <name>Zone 1</name>
+    <parent type="1">n003_hub</parent>
+    <type>1.2.0.0</type>
+    <enabled>true</enabled>
+    <pnode>n003_hub</pnode>
+  </node>
+  <properties>
+    <property id="ST" value="0" formatted="Off" uom="2"/>
+    <property id="CLITEMP" value="215" formatted="21.5°C" uom="4" prec="1"/>
+  </properties>
+</nodeInfo>`,
+			&Node{
+				Address:     "n003_zone1",
+				Name:        "Zone 1",
+				Type:        "1.2.0.0",
+				NodeDefID:   "zone",
+				Parent:      "n003_hub",
+				PrimaryNode: "n003_hub",
+				Enabled:     true,
+				Properties: []Property{
+					{ID: "ST", Value: "0", Formatted: "Off", UOM: UOMBoolean},
+					{ID: "CLITEMP", Value: "215", Formatted: "21.5°C", UOM: UOMCelsius, Precision: 1},
+				},
+			},
+			nil,
+		},
+		{
+			"json",
+			`{"node": {"nodeDefId": "zone", "address": "n003_zone1", "name": "Zone 1", "enabled": false}, "properties": [{"id": "CLITEMP", "value": 725, "formatted": "72.5°F", "uom": 17, "prec": 1}]}`,
+			&Node{
+				Address:   "n003_zone1",
+				Name:      "Zone 1",
+				NodeDefID: "zone",
+				Properties: []Property{
+					{ID: "CLITEMP", Value: "725", Formatted: "72.5°F", UOM: UOMFahrenheit, Precision: 1},
+				},
+			},
+			nil,
+		},
+		{
+			"not found",
+			`<RestResponse succeeded="false"><status>404</status></RestResponse>`,
+			nil,
+			ErrNodeNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			got, err := decodeNodeInfo([]byte(test.Body))
+			if err != test.WantErr {
+				t.Fatalf("wrong error %v; want %v", err, test.WantErr)
+			}
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(test.Want))
+			}
+		})
+	}
+}
+
+func TestPropertyFloat(t *testing.T) {
+	tests := []struct {
+		Prop    Property
+		Want    float64
+		WantErr string
+	}{
+		{Property{Value: "68"}, 68, ""},
+		{Property{Value: "725", Precision: 1}, 72.5, ""},
+		{Property{Value: "-1234", Precision: 2}, -12.34, ""},
+		{Property{Value: "", Precision: 1}, 0, `invalid numeric value ""`},
+		{Property{Value: "on"}, 0, `invalid numeric value "on"`},
+	}
+
+	for _, test := range tests {
+		got, err := test.Prop.Float()
+		if test.WantErr != "" {
+			if err == nil || err.Error() != test.WantErr {
+				t.Errorf("wrong error for %#v\ngot:  %v\nwant: %s", test.Prop, err, test.WantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %#v: %s", test.Prop, err)
+			continue
+		}
+		if math.Abs(got-test.Want) > 1e-9 {
+			t.Errorf("wrong result for %#v\ngot:  %v\nwant: %v", test.Prop, got, test.Want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package isy
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// NSConfig is the ISY's record of how to reach the node server installed
+// in a particular profile slot.
+type NSConfig struct {
+	ProfileNum int
+	Name       string
+	Enabled    bool
+
+	// Host, Port, BaseURL and SSL together describe the URL the ISY uses
+	// to make requests to the node server. Use URL to obtain it.
+	Host    string
+	Port    int
+	BaseURL string
+	SSL     bool
+
+	// Username is the username the ISY sends to the node server. The
+	// password is not returned.
+	Username string
+
+	// ISYUserNum is the ISY user that the node server is associated with.
+	ISYUserNum int
+}
+
+// URL returns the base URL that the ISY uses to make requests to the node
+// server.
+func (c *NSConfig) URL() *url.URL {
+	scheme := "http"
+	if c.SSL {
+		scheme = "https"
+	}
+	host := c.Host
+	if c.Port != 0 {
+		host = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	}
+	return &url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   c.BaseURL,
+	}
+}
+
+// RemoveNodeServer asks the ISY to forget the node server installed in the
+// given profile slot, removing all of its nodes and its profile.
+func (c *client) RemoveNodeServer(profileNum int) error {
+	return c.RemoveNodeServerContext(context.Background(), profileNum)
+}
+
+// RemoveNodeServerContext is like RemoveNodeServer but allows the request
+// to be cancelled or bounded by the given context.
+func (c *client) RemoveNodeServerContext(ctx context.Context, profileNum int) error {
+	path := fmt.Sprintf("./rest/profiles/ns/%d/remove", profileNum)
+	body, err := c.restRequest(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	return checkRestResponse(body)
+}
+
+type nsConnectionsRaw struct {
+	Connections []nsConnectionRaw `xml:"connection"`
+}
+
+type nsConnectionRaw struct {
+	Profile    int    `xml:"profile,attr"`
+	Enabled    bool   `xml:"enabled,attr"`
+	SSL        bool   `xml:"ssl,attr"`
+	ISYUserNum int    `xml:"isyusernum,attr"`
+	Name       string `xml:"name"`
+	IP         string `xml:"ip"`
+	Port       int    `xml:"port"`
+	BaseURL    string `xml:"baseurl"`
+	Username   string `xml:"nsuser"`
+}
+
+// GetNodeServerConfig returns the ISY's configuration for the node server
+// in the given profile slot.
+func (c *client) GetNodeServerConfig(profileNum int) (*NSConfig, error) {
+	return c.GetNodeServerConfigContext(context.Background(), profileNum)
+}
+
+// GetNodeServerConfigContext is like GetNodeServerConfig but allows the
+// request to be cancelled or bounded by the given context.
+func (c *client) GetNodeServerConfigContext(ctx context.Context, profileNum int) (*NSConfig, error) {
+	path := fmt.Sprintf("./rest/profiles/ns/%d/connection", profileNum)
+	body, err := c.restRequest(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeNodeServerConfig(body)
+}
+
+func decodeNodeServerConfig(body []byte) (*NSConfig, error) {
+	var raw nsConnectionsRaw
+	err := xml.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response from ISY: %s", err)
+	}
+	if len(raw.Connections) == 0 {
+		return nil, errors.New("no node server is installed in this profile slot")
+	}
+
+	conn := raw.Connections[0]
+	return &NSConfig{
+		ProfileNum: conn.Profile,
+		Name:       conn.Name,
+		Enabled:    conn.Enabled,
+		Host:       conn.IP,
+		Port:       conn.Port,
+		BaseURL:    conn.BaseURL,
+		SSL:        conn.SSL,
+		Username:   conn.Username,
+		ISYUserNum: conn.ISYUserNum,
+	}, nil
+}
+
+// UploadProfile uploads a profile zip archive, such as one produced by
+// the profile package, for the node server in the given profile slot.
+//
+// The ISY does not begin using the new profile until ReloadProfile is
+// called.
+func (c *client) UploadProfile(profileNum int, zip io.Reader) error {
+	return c.UploadProfileContext(context.Background(), profileNum, zip)
+}
+
+// UploadProfileContext is like UploadProfile but allows the request to be
+// cancelled or bounded by the given context.
+func (c *client) UploadProfileContext(ctx context.Context, profileNum int, zip io.Reader) error {
+	path := fmt.Sprintf("./rest/ns/profile/%d/upload/zip/profile.zip", profileNum)
+	body, err := c.restPost(ctx, path, "application/zip", zip)
+	if err != nil {
+		return err
+	}
+
+	return checkRestResponse(body)
+}
+
+// ReloadProfile asks the ISY to reload the profile of the node server in
+// the given profile slot, such as after a call to UploadProfile.
+func (c *client) ReloadProfile(profileNum int) error {
+	return c.ReloadProfileContext(context.Background(), profileNum)
+}
+
+// ReloadProfileContext is like ReloadProfile but allows the request to be
+// cancelled or bounded by the given context.
+func (c *client) ReloadProfileContext(ctx context.Context, profileNum int) error {
+	path := fmt.Sprintf("./rest/ns/profile/%d/reload", profileNum)
+	body, err := c.restRequest(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	return checkRestResponse(body)
+}
@@ -0,0 +1,110 @@
+package isy
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestClientUploadProfile(t *testing.T) {
+	client, reqs := testClient(t, 200, `<RestResponse succeeded="true"><status>200</status></RestResponse>`)
+
+	err := client.UploadProfile(3, strings.NewReader("zip data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*reqs) != 1 {
+		t.Fatalf("made %d requests; want 1", len(*reqs))
+	}
+	req := (*reqs)[0]
+	if got, want := req.Method, "POST"; got != want {
+		t.Errorf("wrong method %q; want %q", got, want)
+	}
+	if got, want := req.URL.String(), "http://127.0.0.1/rest/ns/profile/3/upload/zip/profile.zip"; got != want {
+		t.Errorf("wrong URL %q; want %q", got, want)
+	}
+	if got, want := req.Header.Get("Content-Type"), "application/zip"; got != want {
+		t.Errorf("wrong Content-Type %q; want %q", got, want)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), "zip data"; got != want {
+		t.Errorf("wrong body %q; want %q", got, want)
+	}
+}
+
+func TestClientReloadProfile(t *testing.T) {
+	client, reqs := testClient(t, 200, `<RestResponse succeeded="false"><status>404</status></RestResponse>`)
+
+	err := client.ReloadProfile(3)
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if got, want := err.Error(), "request failed with status 404"; got != want {
+		t.Errorf("wrong error %q; want %q", got, want)
+	}
+
+	if got, want := (*reqs)[0].URL.String(), "http://127.0.0.1/rest/ns/profile/3/reload"; got != want {
+		t.Errorf("wrong URL %q; want %q", got, want)
+	}
+}
+
+func TestClientGetNodeServerConfig(t *testing.T) {
+	client, reqs := testClient(t, 200, `<?xml version="1.0" encoding="UTF-8"?>
+<connections>
+  <connection profile="3" type="1" timeout="0" isyusernum="0" ssl="true" enabled="true">
+    <name>Weather</name>
+    <ip>192.168.1.10</ip>
+    <port>8443</port>
+    <baseurl>/ns</baseurl>
+    <nsuser>isy</nsuser>
+    <nspwd></nspwd>
+  </connection>
+</connections>
+`)
+
+	got, err := client.GetNodeServerConfig(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &NSConfig{
+		ProfileNum: 3,
+		Name:       "Weather",
+		Enabled:    true,
+		Host:       "192.168.1.10",
+		Port:       8443,
+		BaseURL:    "/ns",
+		SSL:        true,
+		Username:   "isy",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	if got, want := got.URL().String(), "https://192.168.1.10:8443/ns"; got != want {
+		t.Errorf("wrong URL %q; want %q", got, want)
+	}
+	if got, want := (*reqs)[0].URL.String(), "http://127.0.0.1/rest/profiles/ns/3/connection"; got != want {
+		t.Errorf("wrong request URL %q; want %q", got, want)
+	}
+}
+
+func TestClientRemoveNodeServer(t *testing.T) {
+	client, reqs := testClient(t, 200, `<RestResponse succeeded="true"><status>200</status></RestResponse>`)
+
+	err := client.RemoveNodeServer(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := (*reqs)[0].URL.String(), "http://127.0.0.1/rest/profiles/ns/3/remove"; got != want {
+		t.Errorf("wrong URL %q; want %q", got, want)
+	}
+}
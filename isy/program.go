@@ -0,0 +1,78 @@
+package isy
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+)
+
+// ProgramCommand is a command that can be applied to a program using
+// RunProgram.
+type ProgramCommand string
+
+const (
+	ProgramRun     ProgramCommand = "run"
+	ProgramRunThen ProgramCommand = "runThen"
+	ProgramRunElse ProgramCommand = "runElse"
+	ProgramStop    ProgramCommand = "stop"
+	ProgramEnable  ProgramCommand = "enable"
+	ProgramDisable ProgramCommand = "disable"
+)
+
+// RunProgram applies the given command to the program with the given id.
+func (c *client) RunProgram(id int, command ProgramCommand) error {
+	return c.RunProgramContext(context.Background(), id, command)
+}
+
+// RunProgramContext is like RunProgram but allows the request to be
+// cancelled or bounded by the given context.
+func (c *client) RunProgramContext(ctx context.Context, id int, command ProgramCommand) error {
+	path := fmt.Sprintf("./rest/programs/%s/%s", formatProgramID(id), command)
+	body, err := c.restRequestData(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	return checkRestResponse(body)
+}
+
+// formatProgramID formats a program id in the four-digit hex form that the
+// ISY uses in its REST API.
+func formatProgramID(id int) string {
+	return fmt.Sprintf("%04X", id)
+}
+
+type restResponseRaw struct {
+	Succeeded bool   `xml:"succeeded,attr"`
+	Status    string `xml:"status"`
+}
+
+type restResponseJSON struct {
+	Succeeded jsonScalar `json:"succeeded"`
+	Status    jsonScalar `json:"status"`
+}
+
+// checkRestResponse returns an error if the given body is a RestResponse
+// document, in either XML or JSON, indicating that the request failed.
+func checkRestResponse(body []byte) error {
+	var raw restResponseRaw
+	if isJSON(body) {
+		var j restResponseJSON
+		err := json.Unmarshal(body, &j)
+		if err != nil {
+			return fmt.Errorf("invalid response from ISY: %s", err)
+		}
+		raw.Succeeded = j.Succeeded == "true"
+		raw.Status = string(j.Status)
+	} else {
+		err := xml.Unmarshal(body, &raw)
+		if err != nil {
+			return fmt.Errorf("invalid response from ISY: %s", err)
+		}
+	}
+	if !raw.Succeeded {
+		return fmt.Errorf("request failed with status %s", raw.Status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package isy
+
+import (
+	"testing"
+)
+
+func TestClientRunProgram(t *testing.T) {
+	tests := []struct {
+		ID       int
+		Command  ProgramCommand
+		WantPath string
+	}{
+		{0x1, ProgramRun, "/rest/programs/0001/run"},
+		{0x2A, ProgramRunThen, "/rest/programs/002A/runThen"},
+		{0x1B3, ProgramRunElse, "/rest/programs/01B3/runElse"},
+		{0xF00, ProgramStop, "/rest/programs/0F00/stop"},
+		{0x1C2D, ProgramEnable, "/rest/programs/1C2D/enable"},
+		{0xFFFF, ProgramDisable, "/rest/programs/FFFF/disable"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.WantPath, func(t *testing.T) {
+			client, reqs := testClient(t, 200, `<RestResponse succeeded="true"><status>200</status></RestResponse>`)
+			err := client.RunProgram(test.ID, test.Command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(*reqs) != 1 {
+				t.Fatalf("made %d requests; want 1", len(*reqs))
+			}
+			if got := (*reqs)[0].URL.Path; got != test.WantPath {
+				t.Errorf("wrong path\ngot:  %s\nwant: %s", got, test.WantPath)
+			}
+		})
+	}
+}
+
+func TestClientRunProgramFailed(t *testing.T) {
+	client, _ := testClient(t, 200, `<RestResponse succeeded="false"><status>404</status></RestResponse>`)
+	err := client.RunProgram(0x1234, ProgramRun)
+	if err == nil {
+		t.Fatal("succeeded; want error")
+	}
+	if got, want := err.Error(), "request failed with status 404"; got != want {
+		t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestClientRunProgramJSON(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Body    string
+		WantErr string
+	}{
+		{"success", `{"succeeded":true,"status":"200"}`, ""},
+		{"success as string", `{"succeeded":"true","status":200}`, ""},
+		{"failed", `{"succeeded":false,"status":"404"}`, "request failed with status 404"},
+		{"invalid", `{"succeeded":[]}`, "invalid response from ISY: expected string, number or boolean, got []"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			client, reqs := testClient(t, 200, test.Body)
+			client.PreferJSON = true
+
+			err := client.RunProgram(0x1234, ProgramRun)
+			switch {
+			case test.WantErr == "" && err != nil:
+				t.Fatal(err)
+			case test.WantErr != "" && err == nil:
+				t.Fatal("succeeded; want error")
+			case test.WantErr != "" && err.Error() != test.WantErr:
+				t.Errorf("wrong error\ngot:  %s\nwant: %s", err, test.WantErr)
+			}
+			if got, want := (*reqs)[0].Header.Get("Accept"), "application/json, text/xml;q=0.9"; got != want {
+				t.Errorf("wrong Accept header %q; want %q", got, want)
+			}
+		})
+	}
+}
@@ -1,58 +1,245 @@
 package isy
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"reflect"
 	"strings"
 )
 
+// SOAPVersion selects the version of the SOAP protocol used for requests
+// made through a client.
+type SOAPVersion int
+
+const (
+	// SOAP12 is SOAP 1.2, which is the version the ISY's main service
+	// expects and the default.
+	SOAP12 SOAPVersion = iota
+
+	// SOAP11 is SOAP 1.1, which some other services accept instead.
+	SOAP11
+)
+
+const (
+	soap12EnvelopeNamespace = "http://www.w3.org/2003/05/soap-envelope"
+	soap11EnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+)
+
+func (v SOAPVersion) String() string {
+	switch v {
+	case SOAP12:
+		return "SOAP 1.2"
+	case SOAP11:
+		return "SOAP 1.1"
+	default:
+		return fmt.Sprintf("SOAPVersion(%d)", int(v))
+	}
+}
+
+func (v SOAPVersion) envelopeNamespace() string {
+	if v == SOAP11 {
+		return soap11EnvelopeNamespace
+	}
+	return soap12EnvelopeNamespace
+}
+
+// actionHeader returns the value of the SOAPAction header for the given
+// action. SOAP 1.1 requires the value to be a quoted string, while the ISY
+// expects it unquoted with SOAP 1.2.
+func (v SOAPVersion) actionHeader(action string) string {
+	if v == SOAP11 {
+		return `"` + action + `"`
+	}
+	return action
+}
+
 type soapMessage struct {
 	Action string
 	Body   []byte
 }
 
 type soapEnvelope struct {
-	XMLName string `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	XMLName xml.Name
 	Body    soapBody
 }
 
 type soapBody struct {
-	XMLName string `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
-	Content interface{}
+	XMLName xml.Name
+	Content soapContent
+}
+
+// soapContent wraps a request object so that it can be placed in the
+// service namespace if its XMLName tag doesn't specify a namespace itself.
+type soapContent struct {
+	Namespace string
+	Value     interface{}
 }
 
-func makeSOAPMessage(obj interface{}) (soapMessage, error) {
-	action := getSOAPAction(obj)
-	body, err := formatSOAPEnvelope(obj)
+func (c soapContent) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	name := getSOAPElementName(c.Namespace, c.Value)
+	return e.EncodeElement(c.Value, xml.StartElement{Name: name})
+}
+
+func makeSOAPMessage(version SOAPVersion, serviceURN string, obj interface{}) (soapMessage, error) {
+	action := getSOAPAction(serviceURN, obj)
+	body, err := formatSOAPEnvelope(version, serviceURN, obj)
 	return soapMessage{
 		Action: action,
 		Body:   body,
 	}, err
 }
 
-func formatSOAPEnvelope(obj interface{}) ([]byte, error) {
+func formatSOAPEnvelope(version SOAPVersion, serviceURN string, obj interface{}) ([]byte, error) {
+	ns := version.envelopeNamespace()
 	env := soapEnvelope{
+		XMLName: xml.Name{Space: ns, Local: "Envelope"},
 		Body: soapBody{
-			Content: obj,
+			XMLName: xml.Name{Space: ns, Local: "Body"},
+			Content: soapContent{
+				Namespace: serviceURN,
+				Value:     obj,
+			},
 		},
 	}
 	return xml.MarshalIndent(&env, "", "  ")
 }
 
-func getSOAPAction(obj interface{}) string {
+func getSOAPAction(serviceURN string, obj interface{}) string {
+	name := getSOAPElementName(serviceURN, obj)
+	if name.Local == "" {
+		return ""
+	}
+
+	return name.Space + "#" + name.Local
+}
+
+// getSOAPElementName returns the element name given in the XMLName tag of
+// the given object, using serviceURN as the namespace if the tag doesn't
+// include one.
+func getSOAPElementName(serviceURN string, obj interface{}) xml.Name {
 	ty := reflect.TypeOf(obj)
 	if ty.Kind() == reflect.Ptr {
 		ty = ty.Elem()
 	}
 
 	if ty.Kind() != reflect.Struct {
-		return ""
+		return xml.Name{}
 	}
 
 	nameField, exists := ty.FieldByName("XMLName")
 	if !exists {
-		return ""
+		return xml.Name{}
 	}
 
-	return strings.Replace(nameField.Tag.Get("xml"), " ", "#", 1)
+	tag := nameField.Tag.Get("xml")
+	if space := strings.Index(tag, " "); space != -1 {
+		return xml.Name{Space: tag[:space], Local: tag[space+1:]}
+	}
+	return xml.Name{Space: serviceURN, Local: tag}
+}
+
+// SOAPFault is the error type returned when the ISY responds to a request
+// with a SOAP fault.
+type SOAPFault struct {
+	Code   string
+	String string
+	Detail string
+}
+
+func (f *SOAPFault) Error() string {
+	if f.Code == "" {
+		return fmt.Sprintf("SOAP fault: %s", f.String)
+	}
+	return fmt.Sprintf("SOAP fault %s: %s", f.Code, f.String)
+}
+
+// soapFaultRaw accepts both the SOAP 1.1 and SOAP 1.2 fault structures.
+type soapFaultRaw struct {
+	// SOAP 1.1
+	FaultCode   string       `xml:"faultcode"`
+	FaultString string       `xml:"faultstring"`
+	FaultDetail soapInnerXML `xml:"detail"`
+
+	// SOAP 1.2
+	Code   string       `xml:"Code>Value"`
+	Reason string       `xml:"Reason>Text"`
+	Detail soapInnerXML `xml:"Detail"`
+}
+
+type soapInnerXML struct {
+	Content string `xml:",innerxml"`
+}
+
+// decodeSOAPFault looks for a Fault element in the given response body,
+// returning nil if there isn't one.
+func decodeSOAPFault(body []byte) (*SOAPFault, error) {
+	dec, start, err := findSOAPElement(body, xml.Name{Local: "Fault"})
+	if err != nil || start == nil {
+		return nil, err
+	}
+
+	var raw soapFaultRaw
+	err = dec.DecodeElement(&raw, start)
+	if err != nil {
+		return nil, err
+	}
+
+	fault := &SOAPFault{
+		Code:   raw.FaultCode,
+		String: raw.FaultString,
+		Detail: strings.TrimSpace(raw.FaultDetail.Content),
+	}
+	if fault.Code == "" {
+		fault.Code = raw.Code
+	}
+	if fault.String == "" {
+		fault.String = raw.Reason
+	}
+	if fault.Detail == "" {
+		fault.Detail = strings.TrimSpace(raw.Detail.Content)
+	}
+	return fault, nil
+}
+
+// soapEnvelopeNamespaces are the envelope namespaces of the SOAP versions
+// that the ISY may respond with.
+var soapEnvelopeNamespaces = map[string]bool{
+	soap12EnvelopeNamespace: true,
+	soap11EnvelopeNamespace: true,
+}
+
+// findSOAPElement scans the given response body for the first element with
+// the given name, returning a decoder positioned just after its start
+// element. If no such element is present, the returned start element is nil.
+//
+// If name.Space is empty then an element in any namespace matches. The
+// content of a SOAP Header is never searched, since it may contain elements
+// that coincidentally share a name with those in the body.
+func findSOAPElement(body []byte, name xml.Name) (*xml.Decoder, *xml.StartElement, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return dec, nil, nil
+			}
+			return nil, nil, err
+		}
+
+		open, isOpen := tok.(xml.StartElement)
+		if !isOpen {
+			continue
+		}
+		if open.Name.Local == name.Local && (name.Space == "" || open.Name.Space == name.Space) {
+			return dec, &open, nil
+		}
+		if open.Name.Local == "Header" && soapEnvelopeNamespaces[open.Name.Space] {
+			err := dec.Skip()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
 }
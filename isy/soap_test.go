@@ -1,12 +1,13 @@
 package isy
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
 
 func TestFormatSOAPEnvelope(t *testing.T) {
-	got, err := formatSOAPEnvelope(&testSOAPMessage{})
+	got, err := formatSOAPEnvelope(SOAP12, DefaultServiceURN, &testSOAPMessage{})
 	want := `
 <Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">
   <Body xmlns="http://www.w3.org/2003/05/soap-envelope">
@@ -15,7 +16,7 @@ func TestFormatSOAPEnvelope(t *testing.T) {
 </Envelope>
 `
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 
 	if strings.TrimSpace(string(got)) != strings.TrimSpace(want) {
@@ -24,7 +25,7 @@ func TestFormatSOAPEnvelope(t *testing.T) {
 }
 
 func TestGetSOAPAction(t *testing.T) {
-	got := getSOAPAction(&testSOAPMessage{})
+	got := getSOAPAction("urn:example", &testSOAPMessage{})
 	want := "urn:udi-com:service:X_Insteon_Lighting_Service:1#TestMessage"
 
 	if got != want {
@@ -32,6 +33,99 @@ func TestGetSOAPAction(t *testing.T) {
 	}
 }
 
+func TestGetSOAPActionServiceURN(t *testing.T) {
+	got := getSOAPAction("urn:udi-com:service:X_UDI_Service:1", &testLocalSOAPMessage{})
+	want := "urn:udi-com:service:X_UDI_Service:1#TestLocalMessage"
+
+	if got != want {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestFormatSOAPEnvelopeServiceURN(t *testing.T) {
+	got, err := formatSOAPEnvelope(SOAP12, "urn:udi-com:service:X_UDI_Service:1", &testLocalSOAPMessage{})
+	want := `
+<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">
+  <Body xmlns="http://www.w3.org/2003/05/soap-envelope">
+    <TestLocalMessage xmlns="urn:udi-com:service:X_UDI_Service:1"></TestLocalMessage>
+  </Body>
+</Envelope>
+`
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(got)) != strings.TrimSpace(want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestFormatSOAPEnvelopeSOAP11(t *testing.T) {
+	got, err := formatSOAPEnvelope(SOAP11, DefaultServiceURN, &testSOAPMessage{})
+	want := `
+<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <TestMessage xmlns="urn:udi-com:service:X_Insteon_Lighting_Service:1"></TestMessage>
+  </Body>
+</Envelope>
+`
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(got)) != strings.TrimSpace(want) {
+		t.Errorf("wrong result\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
 type testSOAPMessage struct {
 	XMLName string `xml:"urn:udi-com:service:X_Insteon_Lighting_Service:1 TestMessage"`
 }
+
+type testLocalSOAPMessage struct {
+	XMLName string `xml:"TestLocalMessage"`
+}
+
+func TestDecodeSOAPFault(t *testing.T) {
+	tests := []struct {
+		Name string
+		Body string
+		Want *SOAPFault
+	}{
+		{
+			"no fault",
+			`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><Foo/></s:Body></s:Envelope>`,
+			nil,
+		},
+		{
+			"SOAP 1.1",
+			`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError><errorCode>401</errorCode></UPnPError></detail></s:Fault></s:Body></s:Envelope>`,
+			&SOAPFault{
+				Code:   "s:Client",
+				String: "UPnPError",
+				Detail: "<UPnPError><errorCode>401</errorCode></UPnPError>",
+			},
+		},
+		{
+			"SOAP 1.2",
+			`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><s:Fault><s:Code><s:Value>s:Sender</s:Value></s:Code><s:Reason><s:Text>Bad request</s:Text></s:Reason></s:Fault></s:Body></s:Envelope>`,
+			&SOAPFault{
+				Code:   "s:Sender",
+				String: "Bad request",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			got, err := decodeSOAPFault([]byte(test.Body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
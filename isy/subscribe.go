@@ -0,0 +1,286 @@
+package isy
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var subscribePath *url.URL
+
+const (
+	subscribeProtocol = "ISYSUB"
+	subscribeOrigin   = "com.universal-devices.websockets.isy"
+
+	// subscribeRetryMin and subscribeRetryMax bound the delay between
+	// attempts to re-establish a dropped subscription.
+	subscribeRetryMin = 1 * time.Second
+	subscribeRetryMax = 30 * time.Second
+
+	// defaultHeartbeat is the read timeout used before the ISY has told us
+	// its actual heartbeat interval.
+	defaultHeartbeat = 2 * time.Minute
+)
+
+// Event is a single event delivered by the ISY's event subscription stream.
+type Event struct {
+	SeqNum int
+
+	// Control identifies what kind of event this is. For node status
+	// changes this is the name of the driver that changed, such as "ST".
+	// System events use control names starting with an underscore.
+	Control string
+
+	// Action is the raw value associated with the event.
+	Action string
+
+	// UOM and Precision describe Action for node status changes.
+	UOM       UOM
+	Precision int
+
+	// FormattedAction is the ISY's human-readable rendering of Action, if
+	// provided.
+	FormattedAction string
+
+	// Node is the address of the node the event relates to, if any.
+	Node string
+
+	// EventInfo is the raw XML content of the event's eventInfo element,
+	// whose structure depends on Control.
+	EventInfo string
+
+	// Err is set only on the final event delivered before the channel
+	// returned from Subscribe is closed, if the subscription ended due to
+	// a non-recoverable error.
+	Err error
+}
+
+// IsNodeStatus returns true if the event represents a change to the value
+// of one of a node's drivers.
+func (e *Event) IsNodeStatus() bool {
+	return e.Node != "" && len(e.Control) > 0 && e.Control[0] != '_'
+}
+
+// IsTrigger returns true if the event relates to the ISY's program engine.
+func (e *Event) IsTrigger() bool {
+	return e.Control == "_1"
+}
+
+// IsSystemStatus returns true if the event reports the ISY being busy or
+// idle.
+func (e *Event) IsSystemStatus() bool {
+	return e.Control == "_5"
+}
+
+// isHeartbeat returns true if the event is one of the ISY's periodic
+// heartbeats, whose Action is the number of seconds until the next one.
+func (e *Event) isHeartbeat() bool {
+	return e.Control == "_0"
+}
+
+type eventRaw struct {
+	SeqNum  int    `xml:"seqnum,attr"`
+	Control string `xml:"control"`
+	Action  struct {
+		Value     string `xml:",chardata"`
+		UOM       int    `xml:"uom,attr"`
+		Precision int    `xml:"prec,attr"`
+	} `xml:"action"`
+	Node      string       `xml:"node"`
+	EventInfo soapInnerXML `xml:"eventInfo"`
+	FmtAct    string       `xml:"fmtAct"`
+}
+
+// decodeEvent decodes a single message from the subscription stream. It
+// returns nil without error for messages that are not events, such as the
+// initial subscription response.
+func decodeEvent(msg []byte) (*Event, error) {
+	dec, start, err := findSOAPElement(msg, xml.Name{Local: "Event"})
+	if err != nil || start == nil {
+		return nil, err
+	}
+
+	var raw eventRaw
+	err = dec.DecodeElement(&raw, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		SeqNum:          raw.SeqNum,
+		Control:         raw.Control,
+		Action:          raw.Action.Value,
+		UOM:             UOM(raw.Action.UOM),
+		Precision:       raw.Action.Precision,
+		FormattedAction: raw.FmtAct,
+		Node:            raw.Node,
+		EventInfo:       raw.EventInfo.Content,
+	}, nil
+}
+
+// Subscribe opens the ISY's event subscription stream and delivers events
+// on the returned channel until the given context is cancelled.
+//
+// If the connection is lost it is re-established automatically. If the
+// subscription cannot continue, a final event with Err set is delivered
+// before the channel is closed.
+func (c *client) Subscribe(ctx context.Context) (<-chan Event, error) {
+	conn, err := c.dialSubscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event)
+	go c.runSubscription(ctx, conn, ch)
+	return ch, nil
+}
+
+func (c *client) runSubscription(ctx context.Context, conn *websocket.Conn, ch chan<- Event) {
+	defer close(ch)
+
+	fail := func(err error) {
+		select {
+		case ch <- Event{Err: err}:
+		case <-ctx.Done():
+		}
+	}
+
+	delay := subscribeRetryMin
+	for {
+		err := c.readEvents(ctx, conn, ch)
+		conn.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		if _, fatal := err.(fatalSubscribeError); fatal {
+			fail(err)
+			return
+		}
+
+		for {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+
+			conn, err = c.dialSubscribe(ctx)
+			if err == nil {
+				delay = subscribeRetryMin
+				break
+			}
+			if _, fatal := err.(fatalSubscribeError); fatal {
+				fail(err)
+				return
+			}
+
+			delay *= 2
+			if delay > subscribeRetryMax {
+				delay = subscribeRetryMax
+			}
+		}
+	}
+}
+
+// readEvents reads events from the given connection until it fails.
+func (c *client) readEvents(ctx context.Context, conn *websocket.Conn, ch chan<- Event) error {
+	// Ensure that a cancelled context interrupts a blocking read.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	timeout := defaultHeartbeat
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		ev, err := decodeEvent(msg)
+		if err != nil {
+			// Skip messages we can't understand rather than dropping
+			// the whole subscription.
+			continue
+		}
+		if ev == nil {
+			continue
+		}
+
+		if ev.isHeartbeat() {
+			// Allow for the next heartbeat to be somewhat late before
+			// we consider the connection dead.
+			if secs, err := strconv.Atoi(ev.Action); err == nil && secs > 0 {
+				timeout = 2 * time.Duration(secs) * time.Second
+			}
+			continue
+		}
+
+		select {
+		case ch <- *ev:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *client) dialSubscribe(ctx context.Context) (*websocket.Conn, error) {
+	u := c.BaseURL.ResolveReference(subscribePath)
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+
+	dialer := &websocket.Dialer{
+		Subprotocols:     []string{subscribeProtocol},
+		HandshakeTimeout: defaultTimeout,
+	}
+	if t, ok := c.HTTPClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+		dialer.Proxy = t.Proxy
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(req.Header)
+	err = c.setAuth(req)
+	if err != nil {
+		return nil, err
+	}
+	header := req.Header
+	header.Set("Origin", subscribeOrigin)
+
+	conn, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == 401 || resp.StatusCode == 403 || resp.StatusCode == 404) {
+			return nil, fatalSubscribeError{fmt.Errorf("failed to subscribe: %s", resp.Status)}
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// fatalSubscribeError wraps errors that retrying will not resolve.
+type fatalSubscribeError struct {
+	error
+}
+
+func init() {
+	subscribePath, _ = url.Parse("./rest/subscribe")
+}
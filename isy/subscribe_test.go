@@ -0,0 +1,144 @@
+package isy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		Name string
+		Msg  string
+		Want *Event
+	}{
+		{
+			"subscription response",
+			`<?xml version="1.0"?><SubscriptionResponse><SID>uuid:47</SID><duration>0</duration></SubscriptionResponse>`,
+			nil,
+		},
+		{
+			"node status",
+			`<?xml version="1.0"?><Event seqnum="12" sid="uuid:47"><control>ST</control><action uom="51" prec="0">100</action><node>1A 2B 3C 1</node><eventInfo></eventInfo><fmtAct>100%</fmtAct></Event>`,
+			&Event{
+				SeqNum:          12,
+				Control:         "ST",
+				Action:          "100",
+				UOM:             UOMPercent,
+				FormattedAction: "100%",
+				Node:            "1A 2B 3C 1",
+			},
+		},
+		{
+			"heartbeat",
+			`<?xml version="1.0"?><Event seqnum="0" sid="uuid:47"><control>_0</control><action>120</action><node></node><eventInfo></eventInfo></Event>`,
+			&Event{
+				Control: "_0",
+				Action:  "120",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			got, err := decodeEvent([]byte(test.Msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestClientSubscribeReconnect(t *testing.T) {
+	event := func(seq int, control, action string) []byte {
+		return []byte(fmt.Sprintf(`<?xml version="1.0"?><Event seqnum="%d" sid="uuid:47"><control>%s</control><action>%s</action><node>1A 2B 3C 1</node><eventInfo></eventInfo></Event>`, seq, control, action))
+	}
+
+	var mu sync.Mutex
+	var conns int
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{subscribeProtocol},
+		CheckOrigin:  func(r *http.Request) bool { return true },
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/subscribe" {
+			http.NotFound(w, r)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		mu.Lock()
+		conns++
+		n := conns
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			// A heartbeat promising another within a second, which never
+			// arrives, so the client must give up on this connection.
+			conn.WriteMessage(websocket.TextMessage, event(1, "_0", "1"))
+			conn.WriteMessage(websocket.TextMessage, event(2, "ST", "100"))
+			time.Sleep(5 * time.Second)
+		case 2:
+			// The connection is dropped straight after an event.
+			conn.WriteMessage(websocket.TextMessage, event(3, "ST", "0"))
+		default:
+			conn.WriteMessage(websocket.TextMessage, event(4, "ST", "50"))
+			conn.ReadMessage() // wait for the client to go away
+		}
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(&ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	ch, err := client.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for len(got) < 3 {
+		ev, ok := <-ch
+		if !ok {
+			t.Fatalf("channel closed after %d events", len(got))
+		}
+		if ev.Err != nil {
+			t.Fatalf("unexpected error: %s", ev.Err)
+		}
+		got = append(got, fmt.Sprintf("%d %s %s", ev.SeqNum, ev.Control, ev.Action))
+	}
+	cancel()
+
+	want := []string{"2 ST 100", "3 ST 0", "4 ST 50"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong events\ngot:  %#v\nwant: %#v", got, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 3 {
+		t.Errorf("subscriber made %d connections; want 3", conns)
+	}
+
+	// Once the context is cancelled the channel must be closed.
+	for range ch {
+	}
+}
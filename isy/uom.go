@@ -1,6 +1,10 @@
 package isy
 
-//go:generate stringer -type=UOM
+import (
+	"fmt"
+)
+
+// UOM is a unit of measure, as defined by the ISY's standard table of units.
 type UOM int
 
 const (
@@ -112,3 +116,217 @@ const (
 	UOMInch                       UOM = 105
 	UOMMillimetersPerDay          UOM = 106
 )
+
+var uomNames = map[UOM]string{
+	UOMUnknown:                    "unknown",
+	UOMAmpere:                     "ampere",
+	UOMBoolean:                    "boolean",
+	UOMBTUPerHour:                 "BTU per hour",
+	UOMCelsius:                    "degrees Celsius",
+	UOMCentimeter:                 "centimeters",
+	UOMCubicFeet:                  "cubic feet",
+	UOMCubicFeetPerMinute:         "cubic feet per minute",
+	UOMCubicMeter:                 "cubic meters",
+	UOMDay:                        "day",
+	UOMDays:                       "days",
+	UOMDeadboltStatus:             "deadbolt status",
+	UOMDecibel:                    "decibels",
+	UOMDecibelA:                   "decibels A",
+	UOMDegree:                     "degrees",
+	UOMDoorLockStatus:             "door lock status",
+	UOMEuropeanMacroseismic:       "European macroseismic",
+	UOMFahrenheit:                 "degrees Fahrenheit",
+	UOMFeet:                       "feet",
+	UOMHour:                       "hour",
+	UOMHours:                      "hours",
+	UOMAbsoluteHumidity:           "absolute humidity",
+	UOMRelativeHumidity:           "relative humidity",
+	UOMInchesOfMercury:            "inches of mercury",
+	UOMInchesPerHour:              "inches per hour",
+	UOMIndex:                      "index",
+	UOMKelvin:                     "kelvin",
+	UOMKeyword:                    "keyword",
+	UOMKilogram:                   "kilograms",
+	UOMKilovolt:                   "kilovolts",
+	UOMKilowatt:                   "kilowatts",
+	UOMKilopascal:                 "kilopascals",
+	UOMKilometersPerHour:          "kilometers per hour",
+	UOMKilowattHour:               "kilowatt hours",
+	UOMLiedu:                      "liedu",
+	UOMLiter:                      "liters",
+	UOMLux:                        "lux",
+	UOMMercalli:                   "Mercalli",
+	UOMMeter:                      "meters",
+	UOMCubicMetersPerHour:         "cubic meters per hour",
+	UOMMetersPerSecond:            "meters per second",
+	UOMMilliamp:                   "milliamps",
+	UOMMillisecond:                "milliseconds",
+	UOMMillivolt:                  "millivolts",
+	UOMMinute:                     "minute",
+	UOMDurationInMinutes:          "duration in minutes",
+	UOMMillimetersPerHOur:         "millimeters per hour",
+	UOMMonth:                      "month",
+	UOMMilesPerHour:               "miles per hour",
+	UOMMetersPerSecond2:           "meters per second squared",
+	UOMOhm:                        "ohms",
+	UOMPercent:                    "percent",
+	UOMPound:                      "pounds",
+	UOMPowerFactor:                "power factor",
+	UOMPartsPerMillion:            "parts per million",
+	UOMPulseCount:                 "pulse count",
+	UOMRawValue:                   "raw value",
+	UOMSecond:                     "second",
+	UOMDurationInSeconds:          "duration in seconds",
+	UOMSeimensPerMeter:            "siemens per meter",
+	UOMBodyWaveMagnituteScale:     "body wave magnitude scale",
+	UOMRichterScale:               "Richter scale",
+	UOMMomentMagnitudeScale:       "moment magnitude scale",
+	UOMSurfaceWaveMagnitudeScale:  "surface wave magnitude scale",
+	UOMShindo:                     "Shindo",
+	UOMSML:                        "SML",
+	UOMThermostatState:            "thermostat heat/cool state",
+	UOMThermostatMode:             "thermostat mode",
+	UOMThermostatFanMode:          "thermostat fan mode",
+	UOMUSGallon:                   "US gallons",
+	UOMUserNumber:                 "user number",
+	UOMUVIndex:                    "UV index",
+	UOMVolt:                       "volts",
+	UOMWatt:                       "watts",
+	UOMWattsPerSquareMeter:        "watts per square meter",
+	UOMWeekday:                    "weekday",
+	UOMWindDirectionDegrees:       "wind direction degrees",
+	UOMYear:                       "year",
+	UOM100On:                      "percent on",
+	UOM100Closed:                  "percent closed",
+	UOMThermostatFanRunState:      "thermostat fan run state",
+	UOMThermostatFanModeOverride:  "thermostat fan mode override",
+	UOMMillimeter:                 "millimeters",
+	UOMKilometer:                  "kilometers",
+	UOMSecureMode:                 "secure mode",
+	UOMElectricalResistivity:      "electrical resistivity",
+	UOMKiloohm:                    "kiloohms",
+	UOMCubicMetersPerCubicMeter:   "cubic meters per cubic meter",
+	UOMWaterActivity:              "water activity",
+	UOMRotationsPerMinute:         "rotations per minute",
+	UOMHertz:                      "hertz",
+	UOMDegreesFromNorthPole:       "degrees from north pole",
+	UOMDegreesFromSouthPole:       "degrees from south pole",
+	UOMPowerManagementAlarmStatus: "power management alarm status",
+	UOMApplianceAlarmStatus:       "appliance alarm status",
+	UOMHomeHealthAlarmStatus:      "home health alarm status",
+	UOMVOCLevel:                   "VOC level",
+	UOMBarrierStatus:              "barrier status",
+	UOMInsteonThermostatMode:      "Insteon thermostat mode",
+	UOMInsteonThermostatFanMode:   "Insteon thermostat fan mode",
+	UOMByteLevel:                  "byte level",
+	UOMDegreesTimesTwo:            "degrees times two",
+	UOMKilowattSecond:             "kilowatt seconds",
+	UOMDollar:                     "dollars",
+	UOMCent:                       "cents",
+	UOMInch:                       "inches",
+	UOMMillimetersPerDay:          "millimeters per day",
+}
+
+// String returns a human-readable name for the unit, such as
+// "degrees Fahrenheit".
+func (u UOM) String() string {
+	if name, ok := uomNames[u]; ok {
+		return name
+	}
+	return fmt.Sprintf("UOM(%d)", int(u))
+}
+
+// Valid returns true if the unit is one of those defined in the ISY's
+// standard table of units.
+func (u UOM) Valid() bool {
+	_, ok := uomNames[u]
+	return ok
+}
+
+// uomScale describes how to convert a value in a particular unit to the base
+// unit of its quantity, as base = value*factor + offset.
+type uomScale struct {
+	quantity string
+	factor   float64
+	offset   float64
+}
+
+var uomScales = map[UOM]uomScale{
+	UOMCelsius:    {"temperature", 1, 0},
+	UOMFahrenheit: {"temperature", 5.0 / 9.0, -32 * 5.0 / 9.0},
+	UOMKelvin:     {"temperature", 1, -273.15},
+
+	UOMMeter:      {"length", 1, 0},
+	UOMCentimeter: {"length", 0.01, 0},
+	UOMMillimeter: {"length", 0.001, 0},
+	UOMKilometer:  {"length", 1000, 0},
+	UOMFeet:       {"length", 0.3048, 0},
+	UOMInch:       {"length", 0.0254, 0},
+
+	UOMMetersPerSecond:   {"speed", 1, 0},
+	UOMKilometersPerHour: {"speed", 1 / 3.6, 0},
+	UOMMilesPerHour:      {"speed", 0.44704, 0},
+
+	UOMCubicMeter: {"volume", 1, 0},
+	UOMLiter:      {"volume", 0.001, 0},
+	UOMCubicFeet:  {"volume", 0.028316846592, 0},
+	UOMUSGallon:   {"volume", 0.003785411784, 0},
+
+	UOMCubicMetersPerHour: {"flow", 1, 0},
+	UOMCubicFeetPerMinute: {"flow", 0.028316846592 * 60, 0},
+
+	UOMMillimetersPerHOur: {"rainfall rate", 1, 0},
+	UOMMillimetersPerDay:  {"rainfall rate", 1.0 / 24, 0},
+	UOMInchesPerHour:      {"rainfall rate", 25.4, 0},
+
+	UOMKilogram: {"mass", 1, 0},
+	UOMPound:    {"mass", 0.45359237, 0},
+
+	UOMKilopascal:      {"pressure", 1, 0},
+	UOMInchesOfMercury: {"pressure", 3.386389, 0},
+
+	UOMWatt:       {"power", 1, 0},
+	UOMKilowatt:   {"power", 1000, 0},
+	UOMBTUPerHour: {"power", 0.29307107, 0},
+
+	UOMKilowattHour:   {"energy", 1, 0},
+	UOMKilowattSecond: {"energy", 1.0 / 3600, 0},
+
+	UOMVolt:      {"voltage", 1, 0},
+	UOMKilovolt:  {"voltage", 1000, 0},
+	UOMMillivolt: {"voltage", 0.001, 0},
+
+	UOMAmpere:   {"current", 1, 0},
+	UOMMilliamp: {"current", 0.001, 0},
+
+	UOMOhm:     {"resistance", 1, 0},
+	UOMKiloohm: {"resistance", 1000, 0},
+
+	UOMMillisecond:       {"duration", 0.001, 0},
+	UOMDurationInSeconds: {"duration", 1, 0},
+	UOMDurationInMinutes: {"duration", 60, 0},
+	UOMHours:             {"duration", 3600, 0},
+	UOMDays:              {"duration", 86400, 0},
+
+	UOMDollar: {"money", 1, 0},
+	UOMCent:   {"money", 0.01, 0},
+}
+
+// Convert converts a value from one unit to another unit measuring the same
+// quantity, such as from UOMCelsius to UOMFahrenheit. It returns an error if
+// the units are not compatible. Converting a value to its own unit always
+// succeeds and returns the value unchanged.
+func Convert(value float64, from, to UOM) (float64, error) {
+	if from == to {
+		return value, nil
+	}
+
+	fromScale, fromOK := uomScales[from]
+	toScale, toOK := uomScales[to]
+	if !fromOK || !toOK || fromScale.quantity != toScale.quantity {
+		return 0, fmt.Errorf("cannot convert from %s to %s", from, to)
+	}
+
+	base := value*fromScale.factor + fromScale.offset
+	return (base - toScale.offset) / toScale.factor, nil
+}
@@ -0,0 +1,67 @@
+package isy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUOMString(t *testing.T) {
+	tests := []struct {
+		UOM  UOM
+		Want string
+	}{
+		{UOMFahrenheit, "degrees Fahrenheit"},
+		{UOMPercent, "percent"},
+		{UOMMillimetersPerDay, "millimeters per day"},
+		{UOM(1000), "UOM(1000)"},
+	}
+
+	for _, test := range tests {
+		got := test.UOM.String()
+		if got != test.Want {
+			t.Errorf("wrong result for %d\ngot:  %s\nwant: %s", int(test.UOM), got, test.Want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		Value   float64
+		From    UOM
+		To      UOM
+		Want    float64
+		WantErr string
+	}{
+		{20, UOMCelsius, UOMFahrenheit, 68, ""},
+		{68, UOMFahrenheit, UOMCelsius, 20, ""},
+		{-40, UOMFahrenheit, UOMCelsius, -40, ""},
+		{0, UOMCelsius, UOMKelvin, 273.15, ""},
+		{32, UOMFahrenheit, UOMKelvin, 273.15, ""},
+		{1, UOMInch, UOMMillimeter, 25.4, ""},
+		{100, UOMKilometersPerHour, UOMMilesPerHour, 62.137119, ""},
+		{1, UOMUSGallon, UOMLiter, 3.785411784, ""},
+		{1, UOMKilowatt, UOMWatt, 1000, ""},
+		{90, UOMDurationInMinutes, UOMHours, 1.5, ""},
+		{7, UOMIndex, UOMIndex, 7, ""},
+		{20, UOMCelsius, UOMPercent, 0, "cannot convert from degrees Celsius to percent"},
+		{1, UOMFeet, UOMKilogram, 0, "cannot convert from feet to kilograms"},
+		{1, UOM(1000), UOMCelsius, 0, "cannot convert from UOM(1000) to degrees Celsius"},
+	}
+
+	for _, test := range tests {
+		got, err := Convert(test.Value, test.From, test.To)
+		if test.WantErr != "" {
+			if err == nil || err.Error() != test.WantErr {
+				t.Errorf("wrong error converting %v from %s to %s\ngot:  %v\nwant: %s", test.Value, test.From, test.To, err, test.WantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error converting %v from %s to %s: %s", test.Value, test.From, test.To, err)
+			continue
+		}
+		if math.Abs(got-test.Want) > 1e-6 {
+			t.Errorf("wrong result converting %v from %s to %s\ngot:  %v\nwant: %v", test.Value, test.From, test.To, got, test.Want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package isy
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+)
+
+// VarType identifies one of the two kinds of variable supported by the ISY.
+type VarType int
+
+const (
+	VarInteger VarType = 1
+	VarState   VarType = 2
+)
+
+type varRaw struct {
+	XMLName xml.Name
+	Value   int `xml:"val"`
+}
+
+// GetVariable returns the current value of the variable of the given type
+// and id.
+func (c *client) GetVariable(typ VarType, id int) (int, error) {
+	return c.GetVariableContext(context.Background(), typ, id)
+}
+
+// GetVariableContext is like GetVariable but allows the request to be
+// cancelled or bounded by the given context.
+func (c *client) GetVariableContext(ctx context.Context, typ VarType, id int) (int, error) {
+	path := fmt.Sprintf("./rest/vars/get/%d/%d", typ, id)
+	body, err := c.restRequest(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+
+	var raw varRaw
+	err = xml.Unmarshal(body, &raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid response from ISY: %s", err)
+	}
+	switch raw.XMLName.Local {
+	case "var":
+		return raw.Value, nil
+	case "RestResponse":
+		// The ISY reports an unknown variable as a failed RestResponse.
+		err = checkRestResponse(body)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("invalid response from ISY: unexpected <%s> element", raw.XMLName.Local)
+}
+
+// SetVariable changes the value of the variable of the given type and id.
+func (c *client) SetVariable(typ VarType, id int, value int) error {
+	return c.SetVariableContext(context.Background(), typ, id, value)
+}
+
+// SetVariableContext is like SetVariable but allows the request to be
+// cancelled or bounded by the given context.
+func (c *client) SetVariableContext(ctx context.Context, typ VarType, id int, value int) error {
+	path := fmt.Sprintf("./rest/vars/set/%d/%d/%d", typ, id, value)
+	body, err := c.restRequest(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	return checkRestResponse(body)
+}
@@ -0,0 +1,129 @@
+package isy
+
+import (
+	"testing"
+)
+
+func TestClientGetVariable(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Type     VarType
+		Body     string
+		WantPath string
+		Want     int
+		WantErr  string
+	}{
+		{
+			"integer",
+			VarInteger,
+			`<?xml version="1.0" encoding="UTF-8"?><var type="1" id="7"><init>0</init><prec>0</prec><val>42</val><ts>20260101 12:00:00</ts></var>`,
+			"/rest/vars/get/1/7",
+			42,
+			"",
+		},
+		{
+			"state",
+			VarState,
+			`<?xml version="1.0" encoding="UTF-8"?><var type="2" id="7"><init>0</init><prec>0</prec><val>-3</val><ts>20260101 12:00:00</ts></var>`,
+			"/rest/vars/get/2/7",
+			-3,
+			"",
+		},
+		{
+			"failed",
+			VarState,
+			`<RestResponse succeeded="false"><status>404</status></RestResponse>`,
+			"/rest/vars/get/2/7",
+			0,
+			"request failed with status 404",
+		},
+		{
+			"unexpected",
+			VarInteger,
+			`<nodes></nodes>`,
+			"/rest/vars/get/1/7",
+			0,
+			"invalid response from ISY: unexpected <nodes> element",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			client, reqs := testClient(t, 200, test.Body)
+			got, err := client.GetVariable(test.Type, 7)
+			if test.WantErr != "" {
+				if err == nil {
+					t.Fatalf("succeeded with %d; want error", got)
+				}
+				if err.Error() != test.WantErr {
+					t.Errorf("wrong error\ngot:  %s\nwant: %s", err, test.WantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != test.Want {
+					t.Errorf("wrong value %d; want %d", got, test.Want)
+				}
+			}
+			if len(*reqs) != 1 {
+				t.Fatalf("made %d requests; want 1", len(*reqs))
+			}
+			if got := (*reqs)[0].URL.Path; got != test.WantPath {
+				t.Errorf("wrong path\ngot:  %s\nwant: %s", got, test.WantPath)
+			}
+		})
+	}
+}
+
+func TestClientSetVariable(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Type     VarType
+		Value    int
+		Body     string
+		WantPath string
+		WantErr  bool
+	}{
+		{
+			"integer",
+			VarInteger,
+			42,
+			`<RestResponse succeeded="true"><status>200</status></RestResponse>`,
+			"/rest/vars/set/1/7/42",
+			false,
+		},
+		{
+			"state",
+			VarState,
+			-3,
+			`<RestResponse succeeded="true"><status>200</status></RestResponse>`,
+			"/rest/vars/set/2/7/-3",
+			false,
+		},
+		{
+			"failed",
+			VarState,
+			1,
+			`<RestResponse succeeded="false"><status>404</status></RestResponse>`,
+			"/rest/vars/set/2/7/1",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			client, reqs := testClient(t, 200, test.Body)
+			err := client.SetVariable(test.Type, 7, test.Value)
+			if (err != nil) != test.WantErr {
+				t.Errorf("wrong result\ngot error: %v\nwant error: %t", err, test.WantErr)
+			}
+			if len(*reqs) != 1 {
+				t.Fatalf("made %d requests; want 1", len(*reqs))
+			}
+			if got := (*reqs)[0].URL.Path; got != test.WantPath {
+				t.Errorf("wrong path\ngot:  %s\nwant: %s", got, test.WantPath)
+			}
+		})
+	}
+}
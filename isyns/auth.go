@@ -0,0 +1,168 @@
+package isyns
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const digestRealm = "go-isy"
+
+// digestNonceLifetime is how long a nonce issued in a Digest challenge
+// remains acceptable.
+const digestNonceLifetime = 5 * time.Minute
+
+// authenticate returns true if the given request carries valid credentials.
+func (s *Server) authenticate(r *http.Request) bool {
+	if s.clientCerts {
+		if verifiedClientCert(r) == nil {
+			return false
+		}
+		if s.clientCertOnly {
+			return true
+		}
+	}
+
+	if s.digestAuth {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Digest ") {
+			return s.checkDigestAuth(r, auth[len("Digest "):])
+		}
+	}
+
+	username, password, authed := r.BasicAuth()
+	if !authed {
+		return false
+	}
+
+	// Both values are always compared, so that the time taken doesn't
+	// reveal which of the two was incorrect.
+	usernameSHA256 := sha256.Sum256([]byte(username))
+	passwordSHA256 := sha256.Sum256([]byte(password))
+	usernameOK := subtle.ConstantTimeCompare(usernameSHA256[:], s.usernameSHA256)
+	passwordOK := subtle.ConstantTimeCompare(passwordSHA256[:], s.passwordSHA256)
+	return usernameOK&passwordOK == 1
+}
+
+// verifiedClientCert returns the TLS client certificate that the given
+// request was made with, or nil if there was no verified certificate.
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// checkDigestAuth verifies the parameters of a Digest Authorization header,
+// as described in RFC 2617.
+func (s *Server) checkDigestAuth(r *http.Request, raw string) bool {
+	params := parseDigestParams(raw)
+
+	if params["realm"] != digestRealm || params["uri"] != r.RequestURI {
+		return false
+	}
+	if alg := params["algorithm"]; alg != "" && alg != "MD5" {
+		return false
+	}
+	if !s.checkNonce(params["nonce"]) {
+		return false
+	}
+
+	// The username is covered by digestHA1, so an incorrect username
+	// produces an incorrect response.
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	var want string
+	switch params["qop"] {
+	case "auth":
+		want = md5Hex(strings.Join([]string{
+			s.digestHA1, params["nonce"], params["nc"], params["cnonce"], "auth", ha2,
+		}, ":"))
+	case "":
+		want = md5Hex(s.digestHA1 + ":" + params["nonce"] + ":" + ha2)
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(want), []byte(params["response"])) == 1
+}
+
+func (s *Server) digestChallenge() string {
+	return fmt.Sprintf(
+		`Digest realm="%s", qop="auth", algorithm=MD5, nonce="%s"`,
+		digestRealm, s.makeNonce(time.Now()),
+	)
+}
+
+// makeNonce produces a nonce that encodes its issue time along with a MAC,
+// so that nonces can be verified without the server retaining state.
+func (s *Server) makeNonce(now time.Time) string {
+	buf := make([]byte, 8, 8+sha256.Size)
+	binary.BigEndian.PutUint64(buf, uint64(now.Unix()))
+	mac := hmac.New(sha256.New, s.nonceKey)
+	mac.Write(buf)
+	buf = mac.Sum(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func (s *Server) checkNonce(nonce string) bool {
+	buf, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(buf) != 8+sha256.Size {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, s.nonceKey)
+	mac.Write(buf[:8])
+	if !hmac.Equal(mac.Sum(nil), buf[8:]) {
+		return false
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint64(buf[:8])), 0)
+	return time.Since(issued) < digestNonceLifetime
+}
+
+// parseDigestParams parses the comma-separated key=value pairs of a Digest
+// Authorization header, where values may be quoted.
+func parseDigestParams(raw string) map[string]string {
+	ret := make(map[string]string)
+	for {
+		raw = strings.TrimLeft(raw, " ,")
+		eq := strings.Index(raw, "=")
+		if eq == -1 {
+			return ret
+		}
+		key := strings.TrimSpace(raw[:eq])
+		raw = raw[eq+1:]
+
+		var value string
+		if strings.HasPrefix(raw, `"`) {
+			end := strings.Index(raw[1:], `"`)
+			if end == -1 {
+				return ret
+			}
+			value = raw[1 : end+1]
+			raw = raw[end+2:]
+		} else {
+			end := strings.Index(raw, ",")
+			if end == -1 {
+				end = len(raw)
+			}
+			value = strings.TrimSpace(raw[:end])
+			raw = raw[end:]
+		}
+		ret[key] = value
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
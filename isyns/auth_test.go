@@ -0,0 +1,102 @@
+package isyns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestServerDigestAuth(t *testing.T) {
+	s, err := NewServer(&Config{
+		Username:   "isy",
+		Password:   "secret",
+		DigestAuth: true,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := parseDigestParams(strings.TrimPrefix(s.digestChallenge(), "Digest "))
+	nonce := challenge["nonce"]
+	uri := "/ns/nodes/n001_foo/query"
+
+	makeReq := func(username, password string) bool {
+		ha1 := md5Hex(username + ":" + digestRealm + ":" + password)
+		ha2 := md5Hex("GET:" + uri)
+		response := md5Hex(ha1 + ":" + nonce + ":00000001:abc:auth:" + ha2)
+		r := httptest.NewRequest("GET", uri, nil)
+		r.Header.Set("Authorization", fmt.Sprintf(
+			`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=auth, nc=00000001, cnonce="abc", response="%s"`,
+			username, digestRealm, nonce, uri, response,
+		))
+		return s.authenticate(r)
+	}
+
+	if !makeReq("isy", "secret") {
+		t.Errorf("valid credentials were rejected")
+	}
+	if makeReq("isy", "wrong") {
+		t.Errorf("invalid password was accepted")
+	}
+	if makeReq("other", "secret") {
+		t.Errorf("invalid username was accepted")
+	}
+}
+
+func TestServerClientCertAuth(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "isy"}}
+	withCert := func(r *http.Request) {
+		r.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	tests := []struct {
+		Name     string
+		CertOnly bool
+		Cert     bool
+		Password string
+		Want     bool
+	}{
+		{"cert and password", false, true, "secret", true},
+		{"cert without password", false, true, "", false},
+		{"password without cert", false, false, "secret", false},
+		{"cert only", true, true, "", true},
+		{"cert only without cert", true, false, "secret", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			s, err := NewServer(&Config{
+				Username:       "isy",
+				Password:       "secret",
+				ClientCAs:      x509.NewCertPool(),
+				ClientCertOnly: test.CertOnly,
+			}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "/ns/nodes/n001_foo/query", nil)
+			if test.Cert {
+				withCert(r)
+			}
+			if test.Password != "" {
+				r.SetBasicAuth("isy", test.Password)
+			}
+			if got := s.authenticate(r); got != test.Want {
+				t.Errorf("wrong result %t; want %t", got, test.Want)
+			}
+			if test.Cert && verifiedClientCert(r) != cert {
+				t.Errorf("verified certificate not returned")
+			}
+		})
+	}
+}
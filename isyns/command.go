@@ -1,10 +1,77 @@
 package isyns
 
 import (
+	"fmt"
+	"math"
+	"strconv"
+
 	"github.com/apparentlymart/go-isy/isy"
 )
 
 type CommandParam struct {
 	Value string
 	UOM   isy.UOM
+
+	// Values contains all of the values given for the parameter, for
+	// commands that send the same parameter multiple times. Value is
+	// always the first of these.
+	Values []string
+}
+
+// Float parses the parameter's value as a number, undoing the scaling of
+// UOMDegreesTimesTwo.
+func (p *CommandParam) Float() (float64, error) {
+	v, err := strconv.ParseFloat(p.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid numeric value %q", p.Value)
+	}
+	if p.UOM == isy.UOMDegreesTimesTwo {
+		v /= 2
+	}
+	return v, nil
+}
+
+// Int parses the parameter's value as a whole number. Values for units
+// that represent enumerations, such as UOMIndex, must be given as integers,
+// while other values are accepted as long as they have no fractional part.
+func (p *CommandParam) Int() (int, error) {
+	if isIntegerUOM(p.UOM) {
+		v, err := strconv.Atoi(p.Value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s value %q", p.UOM, p.Value)
+		}
+		return v, nil
+	}
+
+	v, err := p.Float()
+	if err != nil {
+		return 0, err
+	}
+	if v != math.Trunc(v) {
+		return 0, fmt.Errorf("value %q is not a whole number", p.Value)
+	}
+	return int(v), nil
+}
+
+// Bool interprets the parameter's value as a boolean. For UOMBoolean and
+// UOM100On any non-zero number is true, while a parameter with no unit may
+// use any of the forms accepted by strconv.ParseBool. Parameters with other
+// units are not booleans and so always produce an error.
+func (p *CommandParam) Bool() (bool, error) {
+	switch p.UOM {
+	case isy.UOMBoolean, isy.UOM100On:
+		v, err := strconv.ParseFloat(p.Value, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s value %q", p.UOM, p.Value)
+		}
+		return v != 0, nil
+	case isy.UOMUnknown:
+		v, err := strconv.ParseBool(p.Value)
+		if err != nil {
+			return false, fmt.Errorf("invalid boolean value %q", p.Value)
+		}
+		return v, nil
+	default:
+		return false, fmt.Errorf("a value in %s cannot be used as a boolean", p.UOM)
+	}
 }
@@ -0,0 +1,85 @@
+package isyns
+
+import (
+	"testing"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestCommandParamFloat(t *testing.T) {
+	tests := []struct {
+		Param   CommandParam
+		Want    float64
+		WantErr bool
+	}{
+		{CommandParam{Value: "72.5", UOM: isy.UOMFahrenheit}, 72.5, false},
+		{CommandParam{Value: "145", UOM: isy.UOMDegreesTimesTwo}, 72.5, false},
+		{CommandParam{Value: "-3", UOM: isy.UOMUnknown}, -3, false},
+		{CommandParam{Value: "warm", UOM: isy.UOMFahrenheit}, 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := test.Param.Float()
+		if (err != nil) != test.WantErr {
+			t.Errorf("wrong error for %#v: %v", test.Param, err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("wrong result for %#v\ngot:  %v\nwant: %v", test.Param, got, test.Want)
+		}
+	}
+}
+
+func TestCommandParamInt(t *testing.T) {
+	tests := []struct {
+		Param   CommandParam
+		Want    int
+		WantErr bool
+	}{
+		{CommandParam{Value: "3", UOM: isy.UOMIndex}, 3, false},
+		{CommandParam{Value: "3.0", UOM: isy.UOMIndex}, 0, true},
+		{CommandParam{Value: "100", UOM: isy.UOMPercent}, 100, false},
+		{CommandParam{Value: "100.0", UOM: isy.UOMPercent}, 100, false},
+		{CommandParam{Value: "50.5", UOM: isy.UOMPercent}, 0, true},
+		{CommandParam{Value: "144", UOM: isy.UOMDegreesTimesTwo}, 72, false},
+		{CommandParam{Value: "", UOM: isy.UOMUnknown}, 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := test.Param.Int()
+		if (err != nil) != test.WantErr {
+			t.Errorf("wrong error for %#v: %v", test.Param, err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("wrong result for %#v\ngot:  %v\nwant: %v", test.Param, got, test.Want)
+		}
+	}
+}
+
+func TestCommandParamBool(t *testing.T) {
+	tests := []struct {
+		Param   CommandParam
+		Want    bool
+		WantErr bool
+	}{
+		{CommandParam{Value: "1", UOM: isy.UOMBoolean}, true, false},
+		{CommandParam{Value: "0", UOM: isy.UOMBoolean}, false, false},
+		{CommandParam{Value: "100", UOM: isy.UOM100On}, true, false},
+		{CommandParam{Value: "true", UOM: isy.UOMUnknown}, true, false},
+		{CommandParam{Value: "yes", UOM: isy.UOMUnknown}, false, true},
+		{CommandParam{Value: "on", UOM: isy.UOMBoolean}, false, true},
+		{CommandParam{Value: "1", UOM: isy.UOMFahrenheit}, false, true},
+	}
+
+	for _, test := range tests {
+		got, err := test.Param.Bool()
+		if (err != nil) != test.WantErr {
+			t.Errorf("wrong error for %#v: %v", test.Param, err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("wrong result for %#v\ngot:  %v\nwant: %v", test.Param, got, test.Want)
+		}
+	}
+}
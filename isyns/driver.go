@@ -0,0 +1,213 @@
+package isyns
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+// setDriversConcurrency is the maximum number of driver reports that
+// SetDrivers will have outstanding with the ISY at any one time.
+const setDriversConcurrency = 4
+
+// DriverValue is a single driver value to be reported using SetDrivers.
+type DriverValue struct {
+	Driver string
+	Value  string
+	UOM    isy.UOM
+}
+
+// DriverErrors is implemented by the error returned from SetDrivers and
+// ReportAll when one or more of the individual driver reports fails.
+type DriverErrors interface {
+	error
+
+	// DriverErrors returns the error for each driver that failed, keyed
+	// by driver name or, for ReportAll, by node address and driver name.
+	DriverErrors() map[string]error
+}
+
+// SetDrivers reports several driver values for the same node at once,
+// issuing the reports concurrently. If a driver is given more than once
+// then only its last value is reported.
+//
+// If any of the reports fail, the returned error implements DriverErrors.
+func (p *ProfileClient) SetDrivers(addr string, values []DriverValue) error {
+	reports := make([]driverReport, len(values))
+	for i, v := range values {
+		reports[i] = driverReport{addr: addr, value: v, key: v.Driver}
+	}
+	return p.setDriverReports(reports, false)
+}
+
+// NodeDrivers is the full set of driver values for a single node, for use
+// with ReportAll.
+type NodeDrivers struct {
+	Addr   string
+	Values []DriverValue
+}
+
+// ReportAll force-reports every given driver value of every given node,
+// issuing the reports concurrently. If a driver of a node is given more than
+// once then only its last value is reported. It is intended for re-asserting the
+// full state of all nodes after the ISY or the node server restarts, when
+// the ISY would otherwise have no values or ignore unchanged ones.
+//
+// If any of the reports fail, the returned error implements DriverErrors,
+// with each failure keyed as "<addr>/<driver>".
+func (p *ProfileClient) ReportAll(nodes []NodeDrivers) error {
+	var reports []driverReport
+	for _, node := range nodes {
+		for _, v := range node.Values {
+			reports = append(reports, driverReport{
+				addr:  node.Addr,
+				value: v,
+				key:   node.Addr + "/" + v.Driver,
+			})
+		}
+	}
+	return p.setDriverReports(reports, true)
+}
+
+// driverReport is a single driver value to report, along with the key that
+// identifies it in a driverErrors.
+type driverReport struct {
+	addr  string
+	value DriverValue
+	key   string
+}
+
+func (p *ProfileClient) setDriverReports(reports []driverReport, force bool) error {
+	// Only the last value given for each driver is reported, since the
+	// earlier ones are already out of date and their errors would share a
+	// key with it.
+	index := make(map[string]int, len(reports))
+	unique := make([]driverReport, 0, len(reports))
+	for _, r := range reports {
+		if i, ok := index[r.key]; ok {
+			unique[i] = r
+			continue
+		}
+		index[r.key] = len(unique)
+		unique = append(unique, r)
+	}
+	reports = unique
+
+	var mu sync.Mutex
+	var errs driverErrors
+
+	work := make(chan driverReport)
+	var wg sync.WaitGroup
+	for i := 0; i < setDriversConcurrency && i < len(reports); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				err := p.client.SetDriver(r.addr, r.value.Driver, r.value.Value, r.value.UOM, 0, force)
+				if err != nil {
+					mu.Lock()
+					if errs == nil {
+						errs = make(driverErrors)
+					}
+					errs[r.key] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, r := range reports {
+		work <- r
+	}
+	close(work)
+	wg.Wait()
+
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+type driverErrors map[string]error
+
+func (e driverErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %s", name, e[name])
+	}
+	return fmt.Sprintf("failed to report %d driver(s): %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e driverErrors) DriverErrors() map[string]error {
+	return map[string]error(e)
+}
+
+// maxDriverPrecision is the largest number of decimal places used when
+// reporting a floating point driver value.
+const maxDriverPrecision = 4
+
+// ReportFloatDriver reports a numeric driver value, formatting it as the ISY
+// expects for the given unit.
+//
+// Units that represent enumerations or whole quantities are rounded to an
+// integer, UOMDegreesTimesTwo is scaled appropriately, and other values are
+// reported with only as many decimal places as needed, up to a maximum of
+// four. The number of decimal places is sent to the ISY as the value's
+// precision, so that it displays the value as reported.
+func (p *ProfileClient) ReportFloatDriver(addr, driver string, value float64, uom isy.UOM) error {
+	formatted := formatDriverValue(value, uom)
+	return p.client.SetDriver(addr, driver, formatted, uom, driverValuePrecision(formatted), false)
+}
+
+// driverValuePrecision returns the number of decimal places in a value
+// produced by formatDriverValue.
+func driverValuePrecision(formatted string) int {
+	idx := strings.IndexByte(formatted, '.')
+	if idx == -1 {
+		return 0
+	}
+	return len(formatted) - idx - 1
+}
+
+// formatDriverValue formats a numeric value as a string suitable for
+// reporting with the given unit.
+func formatDriverValue(value float64, uom isy.UOM) string {
+	switch uom {
+	case isy.UOMDegreesTimesTwo:
+		return strconv.FormatInt(int64(math.Round(value*2)), 10)
+	}
+	if isIntegerUOM(uom) {
+		return strconv.FormatInt(int64(math.Round(value)), 10)
+	}
+
+	// Round to our maximum precision first, so that values like
+	// 72.50000001 are reported as 72.5.
+	scale := math.Pow10(maxDriverPrecision)
+	value = math.Round(value*scale) / scale
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// isIntegerUOM returns true if values in the given unit are always whole
+// numbers, such as because they represent an enumeration.
+func isIntegerUOM(uom isy.UOM) bool {
+	switch uom {
+	case isy.UOMBoolean, isy.UOMByteLevel, isy.UOMIndex, isy.UOMPulseCount,
+		isy.UOMDeadboltStatus, isy.UOMDoorLockStatus, isy.UOMThermostatState,
+		isy.UOMThermostatMode, isy.UOMThermostatFanMode,
+		isy.UOMThermostatFanRunState, isy.UOMThermostatFanModeOverride,
+		isy.UOMInsteonThermostatMode, isy.UOMInsteonThermostatFanMode,
+		isy.UOMSecureMode, isy.UOMBarrierStatus, isy.UOMWeekday:
+		return true
+	}
+	return false
+}
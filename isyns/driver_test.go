@@ -0,0 +1,289 @@
+package isyns
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestFormatDriverValue(t *testing.T) {
+	tests := []struct {
+		Value float64
+		UOM   isy.UOM
+		Want  string
+	}{
+		{72.5, isy.UOMFahrenheit, "72.5"},
+		{72, isy.UOMFahrenheit, "72"},
+		{72.50000001, isy.UOMFahrenheit, "72.5"},
+		{-3.25, isy.UOMCelsius, "-3.25"},
+		{21.5, isy.UOMDegreesTimesTwo, "43"},
+		{254.6, isy.UOMByteLevel, "255"},
+		{1, isy.UOMBoolean, "1"},
+	}
+
+	for _, test := range tests {
+		got := formatDriverValue(test.Value, test.UOM)
+		if got != test.Want {
+			t.Errorf("wrong result for %v in %s\ngot:  %s\nwant: %s", test.Value, test.UOM, got, test.Want)
+		}
+	}
+}
+
+func TestProfileClientReportFloatDriver(t *testing.T) {
+	s, rep := newURLReporterServer(t)
+
+	for _, err := range []error{
+		s.ReportFloatDriver("zone1", "ST", 72.5, isy.UOMFahrenheit),
+		s.ReportFloatDriver("zone1", "ST", 72, isy.UOMFahrenheit),
+		s.ReportFloatDriver("zone1", "ST", -3.25, isy.UOMCelsius),
+		s.ReportFloatDriver("zone1", "CLISPH", 21.5, isy.UOMDegreesTimesTwo),
+		s.ReportFloatDriver("zone1", "GV1", 1.23456, isy.UOMUnknown),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/report/status/ST/72.5/17?prec=1",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/report/status/ST/72/17",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/report/status/ST/-3.25/4?prec=2",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/report/status/CLISPH/43/101",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/report/status/GV1/1.2346?prec=4",
+	}
+	if got := rep.urls; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientSetDriver(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 2, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range []error{
+		s.SetDriver("zone1", "ST", "72", isy.UOMFahrenheit),
+		s.SetDriver("zone1", "GV1", "on", isy.UOMUnknown),
+		s.SetDriverForce("zone1", "ST", "72", isy.UOMFahrenheit),
+		s.ReportNodeStatus("zone1", "CLIHUM", "40", isy.UOMPercent),
+		s.ReportNodeStatus("zone1", "GV2", "idle", isy.UOMUnknown),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{ProfileNum: 2, Parts: []string{"nodes", "n002_zone1", "report", "status", "ST", "72", "17"}, Query: url.Values{}},
+		{ProfileNum: 2, Parts: []string{"nodes", "n002_zone1", "report", "status", "GV1", "on"}, Query: url.Values{}},
+		{ProfileNum: 2, Parts: []string{"nodes", "n002_zone1", "report", "status", "ST", "72", "17"}, Query: url.Values{"force": {"true"}}},
+		{ProfileNum: 2, Parts: []string{"nodes", "n002_zone1", "report", "status", "CLIHUM", "40", "51"}, Query: url.Values{}},
+		{ProfileNum: 2, Parts: []string{"nodes", "n002_zone1", "report", "status", "GV2", "idle", "0"}, Query: url.Values{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientSetDriverConcurrent(t *testing.T) {
+	const goroutines = 20
+	const reports = 25
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	attempts := make(map[string]int)
+	var distinct int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Fail the first attempt of some reports so that the retry logic
+		// is exercised too.
+		attempts[r.URL.Path]++
+		if attempts[r.URL.Path] == 1 {
+			distinct++
+			if distinct%7 == 0 {
+				w.WriteHeader(503)
+				return
+			}
+		}
+		seen[r.URL.Path]++
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(&Config{
+		Retry: RetryPolicy{MaxAttempts: 5},
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines*reports)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < reports; i++ {
+				addr := fmt.Sprintf("dev%d", g)
+				errs <- s.SetDriver(addr, "ST", fmt.Sprint(i), isy.UOMPercent)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+	if got, want := len(seen), goroutines*reports; got != want {
+		t.Errorf("ISY received %d distinct reports; want %d", got, want)
+	}
+}
+
+func TestProfileClientReportAll(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.URL.RequestURI())
+		mu.Unlock()
+		if strings.Contains(r.URL.Path, "/GV1/") {
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(&Config{}, 3, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.ReportAll([]NodeDrivers{
+		{
+			Addr: "hub",
+			Values: []DriverValue{
+				{Driver: "ST", Value: "1", UOM: isy.UOMBoolean},
+			},
+		},
+		{
+			Addr: "zone1",
+			Values: []DriverValue{
+				{Driver: "ST", Value: "72.5", UOM: isy.UOMFahrenheit},
+				{Driver: "GV1", Value: "3", UOM: isy.UOMIndex},
+			},
+		},
+	})
+	derrs, ok := err.(DriverErrors)
+	if !ok {
+		t.Fatalf("wrong error %#v; want DriverErrors", err)
+	}
+	if errs := derrs.DriverErrors(); len(errs) != 1 || errs["zone1/GV1"] == nil {
+		t.Errorf("wrong driver errors %#v", errs)
+	}
+
+	sort.Strings(got)
+	want := []string{
+		"/rest/ns/3/nodes/n003_hub/report/status/ST/1/2?force=true",
+		"/rest/ns/3/nodes/n003_zone1/report/status/GV1/3/25?force=true",
+		"/rest/ns/3/nodes/n003_zone1/report/status/ST/72.5/17?force=true",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong requests\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientReportAllDuplicates(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.ReportAll([]NodeDrivers{
+		{Addr: "hub", Values: []DriverValue{{Driver: "ST", Value: "1", UOM: isy.UOMBoolean}}},
+		{Addr: "hub", Values: []DriverValue{{Driver: "ST", Value: "0", UOM: isy.UOMBoolean}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{ProfileNum: 1, Parts: []string{"nodes", "n001_hub", "report", "status", "ST", "0", "2"}, Query: url.Values{"force": {"true"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientSetDriversPartialFailure(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.URL.Path)
+		mu.Unlock()
+		if strings.Contains(r.URL.Path, "/CLIHUM/") {
+			w.WriteHeader(500)
+			io.WriteString(w, "no such driver")
+		}
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(&Config{
+		Logger: &testLogger{},
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SetDrivers("tstat", []DriverValue{
+		{Driver: "ST", Value: "72.5", UOM: isy.UOMFahrenheit},
+		{Driver: "CLIHUM", Value: "40", UOM: isy.UOMPercent},
+		{Driver: "CLIMD", Value: "1", UOM: isy.UOMThermostatMode},
+	})
+	derrs, ok := err.(DriverErrors)
+	if !ok {
+		t.Fatalf("wrong error %#v; want DriverErrors", err)
+	}
+	errs := derrs.DriverErrors()
+	if len(errs) != 1 || errs["CLIHUM"] == nil {
+		t.Fatalf("wrong driver errors %#v", errs)
+	}
+	if got, want := errs["CLIHUM"].Error(), "500 Internal Server Error: no such driver"; got != want {
+		t.Errorf("wrong error for CLIHUM\ngot:  %s\nwant: %s", got, want)
+	}
+	if got, want := err.Error(), "failed to report 1 driver(s): CLIHUM: 500 Internal Server Error: no such driver"; got != want {
+		t.Errorf("wrong error message\ngot:  %s\nwant: %s", got, want)
+	}
+
+	// All of the drivers are reported, including those after the failure.
+	sort.Strings(got)
+	want := []string{
+		"/rest/ns/1/nodes/n001_tstat/report/status/CLIHUM/40/51",
+		"/rest/ns/1/nodes/n001_tstat/report/status/CLIMD/1/67",
+		"/rest/ns/1/nodes/n001_tstat/report/status/ST/72.5/17",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong requests\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package isyns
+
+// Handler is an alternative to reading from Server.Requests, allowing each
+// type of request to be handled by a separate method.
+//
+// If a Handler is set in Config then the server calls the appropriate
+// method for each request, and Requests will never produce any values.
+// Each call is made from the goroutine serving the corresponding ISY
+// request, so methods may be called concurrently.
+//
+// Embed BaseHandler in an implementation to get default implementations of
+// the methods for request types that a node server does not support.
+type Handler interface {
+	HandleInstall(*InstallRequest)
+	HandleQuery(*NodeQueryRequest)
+	HandleStatus(*NodeStatusValuesRequest)
+	HandleAddAllNodes(*AddAllNodesRequest)
+	HandleAddNode(*AddNodeRequest)
+	HandleRemoveNode(*RemoveNodeRequest)
+	HandleRenameNode(*RenameNodeRequest)
+	HandleEnableNode(*EnableNodeRequest)
+	HandleCommand(*CommandRequest)
+	HandleCustomParams(*CustomParamsRequest)
+	HandlePoll(*PollRequest)
+}
+
+// BaseHandler is a Handler that reports every request to the ISY as
+// having failed, and ignores polls. It is intended to be embedded in other
+// Handler implementations.
+type BaseHandler struct{}
+
+var _ Handler = BaseHandler{}
+
+func (BaseHandler) HandleInstall(req *InstallRequest)           { req.Complete(false) }
+func (BaseHandler) HandleQuery(req *NodeQueryRequest)           { req.Complete(false) }
+func (BaseHandler) HandleStatus(req *NodeStatusValuesRequest)   { req.Complete(false) }
+func (BaseHandler) HandleAddAllNodes(req *AddAllNodesRequest)   { req.Complete(false) }
+func (BaseHandler) HandleAddNode(req *AddNodeRequest)           { req.Complete(false) }
+func (BaseHandler) HandleRemoveNode(req *RemoveNodeRequest)     { req.Complete(false) }
+func (BaseHandler) HandleRenameNode(req *RenameNodeRequest)     { req.Complete(false) }
+func (BaseHandler) HandleEnableNode(req *EnableNodeRequest)     { req.Complete(false) }
+func (BaseHandler) HandleCommand(req *CommandRequest)           { req.Complete(false) }
+func (BaseHandler) HandleCustomParams(req *CustomParamsRequest) { req.Complete(false) }
+func (BaseHandler) HandlePoll(req *PollRequest)                 {}
+
+// dispatch calls the method of the given handler that corresponds to the
+// type of the given request.
+func dispatch(h Handler, req Request) {
+	switch req := req.(type) {
+	case *InstallRequest:
+		h.HandleInstall(req)
+	case *NodeQueryRequest:
+		h.HandleQuery(req)
+	case *NodeStatusValuesRequest:
+		h.HandleStatus(req)
+	case *AddAllNodesRequest:
+		h.HandleAddAllNodes(req)
+	case *AddNodeRequest:
+		h.HandleAddNode(req)
+	case *RemoveNodeRequest:
+		h.HandleRemoveNode(req)
+	case *RenameNodeRequest:
+		h.HandleRenameNode(req)
+	case *EnableNodeRequest:
+		h.HandleEnableNode(req)
+	case *CommandRequest:
+		h.HandleCommand(req)
+	case *CustomParamsRequest:
+		h.HandleCustomParams(req)
+	case *PollRequest:
+		h.HandlePoll(req)
+	}
+}
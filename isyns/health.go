@@ -0,0 +1,72 @@
+package isyns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// isyHealthTimeout bounds how long a health check waits for the ISY.
+const isyHealthTimeout = 5 * time.Second
+
+// ISYHealthHandler returns an http.Handler that reports whether the ISY can
+// currently be reached using the server's ISY configuration and
+// credentials. It responds with 200 OK if so and 503 Service Unavailable
+// if not, making it suitable as a readiness probe.
+//
+// The result of each check is reused for the given duration, so that
+// frequent probes don't place extra load on the ISY. Concurrent probes wait
+// for a single check rather than each making their own.
+func (s *Server) ISYHealthHandler(cacheFor time.Duration) http.Handler {
+	return &isyHealth{
+		server:   s,
+		cacheFor: cacheFor,
+	}
+}
+
+type isyHealth struct {
+	server   *Server
+	cacheFor time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func (h *isyHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := h.check(r.Context())
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "ISY is unreachable: %s\n", err)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+// check returns the result of the most recent check of the ISY, making a
+// new check first if that result is too old.
+func (h *isyHealth) check(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.checkedAt.IsZero() && time.Since(h.checkedAt) < h.cacheFor {
+		return h.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, isyHealthTimeout)
+	defer cancel()
+	_, err := h.server.isyClient.GetConfigContext(ctx)
+	if ctx.Err() != nil && err != nil && ctx.Err() != context.DeadlineExceeded {
+		// The probe itself was abandoned, which says nothing about the
+		// ISY, so we don't cache the result.
+		return err
+	}
+	h.checkedAt = time.Now()
+	h.err = err
+	return err
+}
@@ -0,0 +1,74 @@
+package isyns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestServerISYHealthHandler(t *testing.T) {
+	var reqs int32
+	var failing int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		if r.URL.Path != "/rest/config" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "admin" {
+			http.Error(w, "Unauthorized", 401)
+			return
+		}
+		if atomic.LoadInt32(&failing) != 0 {
+			http.Error(w, "Internal Server Error", 500)
+			return
+		}
+		w.Write([]byte(`<configuration><app_version>5.3.4</app_version></configuration>`))
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(&Config{}, 1, &isy.ClientConfig{
+		BaseURL:  ts.URL,
+		Username: "admin",
+		Password: "admin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probe := func(h http.Handler) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz/isy", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	cached := s.ISYHealthHandler(time.Hour)
+	for i := 0; i < 3; i++ {
+		if code, body := probe(cached); code != 200 {
+			t.Errorf("wrong status %d for healthy ISY: %s", code, body)
+		}
+	}
+	if got := atomic.LoadInt32(&reqs); got != 1 {
+		t.Errorf("made %d requests to the ISY; want 1", got)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	uncached := s.ISYHealthHandler(0)
+	code, body := probe(uncached)
+	if code != 503 {
+		t.Errorf("wrong status %d for failing ISY; want 503", code)
+	}
+	if !strings.HasPrefix(body, "ISY is unreachable: ") {
+		t.Errorf("wrong body for failing ISY: %q", body)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	if code, body := probe(uncached); code != 200 {
+		t.Errorf("wrong status %d after ISY recovered: %s", code, body)
+	}
+}
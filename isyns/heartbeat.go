@@ -0,0 +1,65 @@
+package isyns
+
+import (
+	"sync"
+	"time"
+)
+
+// StartHeartbeat starts a watchdog for the node with the given address,
+// calling fn at the given interval and marking the node enabled or disabled
+// on the ISY depending on whether fn reports the device as alive.
+//
+// The node's state is re-asserted on every tick, so that the ISY recovers
+// the correct state even after it restarts. The heartbeat stops when the
+// server shuts down or when the returned function is called.
+func (p *ProfileClient) StartHeartbeat(addr string, interval time.Duration, fn func() bool) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if !p.heartbeat(addr, fn) {
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			case <-p.server.baseCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// heartbeat calls fn and reports the node's state accordingly, returning
+// false if the server is shutting down.
+//
+// Only the report is counted as in flight, in the same way as a poll, so
+// that Shutdown waits for it without also waiting for a slow fn.
+func (p *ProfileClient) heartbeat(addr string, fn func() bool) bool {
+	alive := fn()
+
+	s := p.server
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		return false
+	}
+	s.inFlight.Add(1)
+	s.mu.Unlock()
+	defer s.inFlight.Done()
+
+	err := p.client.SetNodeEnabledContext(s.baseCtx, addr, alive)
+	if err != nil {
+		s.logger.Printf("heartbeat for %s failed: %s", p.client.FormatAddr(addr), err)
+	}
+	return true
+}
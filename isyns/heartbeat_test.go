@@ -0,0 +1,136 @@
+package isyns
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestServerStartHeartbeat(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The device is alive for the first tick and dead thereafter.
+	var ticks int32
+	s.StartHeartbeat("hub", time.Millisecond, func() bool {
+		return atomic.AddInt32(&ticks, 1) == 1
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.Calls()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	want := []RecordedCall{
+		{ProfileNum: 1, Parts: []string{"nodes", "n001_hub", "enable"}, Query: url.Values{}},
+		{ProfileNum: 1, Parts: []string{"nodes", "n001_hub", "disable"}, Query: url.Values{}},
+	}
+	if got := rec.Calls(); len(got) < 2 || !reflect.DeepEqual(got[:2], want) {
+		t.Fatalf("wrong reports\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	err = s.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(rec.Calls())
+	time.Sleep(20 * time.Millisecond)
+	if got := len(rec.Calls()); got != n {
+		t.Errorf("%d heartbeat reports made after Shutdown returned", got-n)
+	}
+}
+
+func TestServerStartHeartbeatStop(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	stop := s.StartHeartbeat("hub", time.Millisecond, func() bool {
+		select {
+		case <-stopped:
+		default:
+			close(stopped)
+		}
+		return true
+	})
+	<-stopped
+	stop()
+	stop() // must be safe to call more than once
+
+	// Allow for a report that was already in progress when we stopped.
+	time.Sleep(10 * time.Millisecond)
+	n := len(rec.Calls())
+	time.Sleep(20 * time.Millisecond)
+	if got := len(rec.Calls()); got != n {
+		t.Errorf("%d heartbeat reports made after stop", got-n)
+	}
+}
+
+func TestProfileClientStartHeartbeat(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddProfile(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := s.Profile(2).StartHeartbeat("hub", time.Hour, func() bool { return true })
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.Calls()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	want := []RecordedCall{
+		{ProfileNum: 2, Parts: []string{"nodes", "n002_hub", "enable"}, Query: url.Values{}},
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong reports\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestServerStartHeartbeatSlowCheck(t *testing.T) {
+	s, err := NewServer(&Config{
+		Reporter: NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checking := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s.StartHeartbeat("hub", time.Hour, func() bool {
+		close(checking)
+		<-release
+		return true
+	})
+	<-checking
+
+	// A device check that never returns must not hold up Shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("Shutdown waited for the device check: %s", err)
+	}
+}
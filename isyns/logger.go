@@ -0,0 +1,34 @@
+package isyns
+
+import (
+	"log"
+)
+
+// Logger is the interface used for all logging by a Server, allowing log
+// output to be routed into an application's own logging system.
+//
+// Printf is used for warnings and errors, while Debugf is used for
+// detailed information such as a record of every request to the ISY.
+//
+// Methods may be called concurrently from multiple goroutines.
+type Logger interface {
+	Printf(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+}
+
+// stdLogger is the Logger used when none is configured. It writes warnings
+// and errors to the given log.Logger, or to the standard logger if nil, and
+// discards debug messages.
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (l stdLogger) Printf(format string, args ...interface{}) {
+	if l.l != nil {
+		l.l.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (l stdLogger) Debugf(format string, args ...interface{}) {}
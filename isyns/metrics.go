@@ -0,0 +1,25 @@
+package isyns
+
+import (
+	"time"
+)
+
+// Metrics is an optional interface for observing the activity of a Server,
+// such as to export statistics to a monitoring system.
+//
+// Methods may be called concurrently from multiple goroutines.
+type Metrics interface {
+	// ObserveRequest is called after each recognized request from the ISY
+	// has been handled, with the kind of request (such as "nodeCommand")
+	// and the time taken to handle it.
+	ObserveRequest(kind string, dur time.Duration)
+
+	// ObserveReport is called after each report is sent to the ISY,
+	// including request completion and driver status reports.
+	ObserveReport(success bool)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveRequest(kind string, dur time.Duration) {}
+func (nopMetrics) ObserveReport(success bool)                    {}
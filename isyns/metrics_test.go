@@ -0,0 +1,78 @@
+package isyns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+type testMetrics struct {
+	mu       sync.Mutex
+	requests []string
+	reports  []bool
+}
+
+func (m *testMetrics) ObserveRequest(kind string, dur time.Duration) {
+	m.mu.Lock()
+	m.requests = append(m.requests, kind)
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) ObserveReport(success bool) {
+	m.mu.Lock()
+	m.reports = append(m.reports, success)
+	m.mu.Unlock()
+}
+
+func TestServerMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/n001_bad/") {
+			http.Error(w, "no such node", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	metrics := &testMetrics{}
+	s, err := NewServer(&Config{
+		Handler: BaseHandler{},
+		Logger:  &testLogger{},
+		Metrics: metrics,
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"/ns/nodes/n001_sw/query?requestId=1",
+		"/ns/nodes/n001_sw/cmd/DON?requestId=2",
+		"/ns/nonsense",
+	} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.SetBasicAuth("", "")
+		s.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if err := s.SetDriver("sw", "ST", "100", isy.UOMPercent); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDriver("bad", "ST", "100", isy.UOMPercent); err == nil {
+		t.Fatal("report for unknown node succeeded; want error")
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	// The unrecognized request is not observed.
+	if got, want := metrics.requests, []string{"nodeQuery", "nodeCommand"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong requests\ngot:  %#v\nwant: %#v", got, want)
+	}
+	// The two requests are each reported as failed by BaseHandler, and
+	// then come the two driver reports.
+	if got, want := metrics.reports, []bool{true, true, true, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong reports\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package isyns
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+// MaxNodeAddrLen is the maximum length of a node address, not including the
+// prefix that identifies its profile.
+const MaxNodeAddrLen = 14
+
+// ValidateNodeAddr returns an error if the given node address, relative to
+// the profile, is not one the ISY will accept. Addresses may contain only
+// lowercase letters, digits and underscores, and must be no longer than
+// MaxNodeAddrLen.
+//
+// The ISY silently refuses to create a node with an invalid address, so
+// AddNode checks addresses with this function before making its request.
+func ValidateNodeAddr(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("node address must not be empty")
+	}
+	if len(addr) > MaxNodeAddrLen {
+		return fmt.Errorf("node address %q is longer than %d characters", addr, MaxNodeAddrLen)
+	}
+	for _, r := range addr {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+		default:
+			return fmt.Errorf("node address %q contains %q; only lowercase letters, digits and underscores are allowed", addr, r)
+		}
+	}
+	return nil
+}
+
+// AddNodeOptions are the arguments to ProfileClient.AddNodeWithOptions.
+// Only Addr and NodeDefID are required.
+type AddNodeOptions struct {
+	// Addr is the node's address, relative to the profile.
+	Addr string
+
+	// NodeDefID is the id of the node definition in the node server's
+	// profile that describes this node's drivers and commands.
+	NodeDefID string
+
+	// Primary is the address of the primary node of the group this node
+	// belongs to, relative to the profile, if it is a secondary node.
+	Primary string
+
+	// Name is the initial display name for the node.
+	Name string
+
+	// Hint optionally describes the category of device the node represents,
+	// which the ISY uses to choose an icon for it. It is a hexadecimal
+	// encoding of four bytes, such as "0x01020000".
+	Hint string
+}
+
+// NodeSpec describes a node to be added to the ISY.
+type NodeSpec struct {
+	// Addr is the node's address, relative to the profile.
+	Addr string
+
+	// NodeDefID is the id of the node definition in the node server's
+	// profile that describes this node's drivers and commands.
+	NodeDefID string
+
+	// Name is the initial display name for the node.
+	Name string
+
+	// Primary is the address of the primary node of the group this node
+	// belongs to, relative to the profile, if it is a secondary node. It
+	// is used by SyncNodes but ignored by AddDevice.
+	Primary string
+
+	// Hint is the device category hint, as for AddNodeOptions.
+	Hint string
+}
+
+// addNodeOptions returns the options for adding the node described by the
+// spec as a member of the group with the given primary node, if any.
+func (s NodeSpec) addNodeOptions(primary string) AddNodeOptions {
+	return AddNodeOptions{
+		Addr:      s.Addr,
+		NodeDefID: s.NodeDefID,
+		Primary:   primary,
+		Name:      s.Name,
+		Hint:      s.Hint,
+	}
+}
+
+// Validate returns an error if the spec cannot describe a valid node.
+func (s NodeSpec) Validate() error {
+	err := ValidateNodeAddr(s.Addr)
+	if err != nil {
+		return err
+	}
+	if s.NodeDefID == "" {
+		return fmt.Errorf("node %s has no node definition id", s.Addr)
+	}
+	return nil
+}
+
+// AddDevice adds a device made up of several nodes to the ISY: a primary
+// node and zero or more secondary nodes that are grouped under it.
+//
+// The primary node is added first, and then each of the secondaries is
+// added with a reference to it. If the primary cannot be added then no
+// secondaries are added. A node that already exists is not considered an
+// error, so AddDevice can be used to ensure that a device is present.
+//
+// All of the specs are validated before any nodes are added.
+func (p *ProfileClient) AddDevice(primary NodeSpec, secondaries []NodeSpec) error {
+	err := primary.Validate()
+	if err != nil {
+		return err
+	}
+	for _, spec := range secondaries {
+		err := spec.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.AddNodeWithOptions(primary.addNodeOptions(""))
+	if err != nil && err != ErrNodeExists {
+		return fmt.Errorf("failed to add primary node %s: %s", primary.Addr, err)
+	}
+
+	for _, spec := range secondaries {
+		err := p.AddNodeWithOptions(spec.addNodeOptions(primary.Addr))
+		if err != nil && err != ErrNodeExists {
+			return fmt.Errorf("failed to add secondary node %s: %s", spec.Addr, err)
+		}
+	}
+
+	return nil
+}
+
+// SyncNodes ensures that the ISY has a node for each of the given specs,
+// adding any that are missing. If removeExtra is set then any other nodes
+// belonging to the profile are removed.
+//
+// Nodes that are already present are left as they are, even if their names
+// differ, since the user may have renamed them. Primary nodes are added
+// before any secondary nodes that refer to them.
+func (p *ProfileClient) SyncNodes(nodes []NodeSpec, removeExtra bool) error {
+	for _, spec := range nodes {
+		err := spec.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	all, err := p.isyClient.GetNodesContext(p.client.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list existing nodes: %s", err)
+	}
+	existing := make(map[string]*isy.Node)
+	for _, node := range all {
+		if addr, ok := p.client.ParseAddr(node.Address); ok {
+			existing[addr] = node
+		}
+	}
+
+	toAdd := make([]NodeSpec, 0, len(nodes))
+	wanted := make(map[string]bool, len(nodes))
+	for _, spec := range nodes {
+		wanted[spec.Addr] = true
+		if existing[spec.Addr] == nil {
+			toAdd = append(toAdd, spec)
+		}
+	}
+	sort.SliceStable(toAdd, func(i, j int) bool {
+		return toAdd[i].Primary == "" && toAdd[j].Primary != ""
+	})
+	for _, spec := range toAdd {
+		err := p.AddNodeWithOptions(spec.addNodeOptions(spec.Primary))
+		if err != nil && err != ErrNodeExists {
+			return fmt.Errorf("failed to add node %s: %s", spec.Addr, err)
+		}
+	}
+
+	if !removeExtra {
+		return nil
+	}
+
+	// Secondary nodes are removed before their primaries, since removing a
+	// primary may also remove its secondaries.
+	var toRemove []*isy.Node
+	for addr, node := range existing {
+		if !wanted[addr] {
+			toRemove = append(toRemove, node)
+		}
+	}
+	sort.Slice(toRemove, func(i, j int) bool {
+		iPrimary := toRemove[i].PrimaryNode == "" || toRemove[i].PrimaryNode == toRemove[i].Address
+		jPrimary := toRemove[j].PrimaryNode == "" || toRemove[j].PrimaryNode == toRemove[j].Address
+		if iPrimary != jPrimary {
+			return jPrimary
+		}
+		return toRemove[i].Address < toRemove[j].Address
+	})
+	for _, node := range toRemove {
+		addr, _ := p.client.ParseAddr(node.Address)
+		err := p.RemoveNode(addr)
+		if err != nil {
+			return fmt.Errorf("failed to remove node %s: %s", addr, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package isyns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestValidateNodeAddr(t *testing.T) {
+	tests := []struct {
+		Addr    string
+		WantErr bool
+	}{
+		{"tstat", false},
+		{"zone_1", false},
+		{"abcdefghij1234", false},
+		{"abcdefghij12345", true},
+		{"", true},
+		{"dev.1", true},
+		{"Tstat", true},
+		{"dev-1", true},
+	}
+
+	for _, test := range tests {
+		err := ValidateNodeAddr(test.Addr)
+		if (err != nil) != test.WantErr {
+			t.Errorf("wrong result for %q\ngot error: %v\nwant error: %t", test.Addr, err, test.WantErr)
+		}
+	}
+}
+
+func TestProfileClientSyncNodes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/nodes" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`<nodes>
+  <node nodeDefId="hub"><address>n003_hub</address><pnode>n003_hub</pnode></node>
+  <node nodeDefId="zone"><address>n003_zone1</address><pnode>n003_hub</pnode></node>
+  <node nodeDefId="old"><address>n003_old</address><pnode>n003_old</pnode></node>
+  <node nodeDefId="oldzone"><address>n003_oldzone</address><pnode>n003_old</pnode></node>
+  <node nodeDefId="other"><address>n004_other</address></node>
+</nodes>`))
+	}))
+	defer ts.Close()
+
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 3, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SyncNodes([]NodeSpec{
+		{Addr: "zone2", NodeDefID: "zone", Name: "Zone 2", Primary: "hub"},
+		{Addr: "hub", NodeDefID: "hub", Name: "Hub"},
+		{Addr: "zone1", NodeDefID: "zone", Name: "Zone 1", Primary: "hub"},
+		{Addr: "new", NodeDefID: "hub", Name: "New", Hint: "0x01020000"},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_new", "add", "hub"},
+			Query:      map[string][]string{"name": {"New"}, "hint": {"0x01020000"}},
+		},
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_zone2", "add", "zone"},
+			Query:      map[string][]string{"name": {"Zone 2"}, "primary": {"n003_hub"}},
+		},
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_oldzone", "remove"},
+			Query:      map[string][]string{},
+		},
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_old", "remove"},
+			Query:      map[string][]string{},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientAddNodeWithOptions(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 3, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.AddNodeWithOptions(AddNodeOptions{
+		Addr:      "zone1",
+		NodeDefID: "zone",
+		Primary:   "hub",
+		Hint:      "0x01020000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddNodeWithOptions(AddNodeOptions{Addr: "Bad.Addr", NodeDefID: "zone"})
+	if err == nil {
+		t.Errorf("invalid address was accepted")
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_zone1", "add", "zone"},
+			Query:      map[string][]string{"primary": {"n003_hub"}, "hint": {"0x01020000"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientAddNodeNameEncoding(t *testing.T) {
+	var rawQueries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQueries = append(rawQueries, r.URL.RawQuery)
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(&Config{}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{
+		"Living Room",
+		"Fan + Light",
+		"Tom & Jerry's",
+		"Café 50%",
+		"🌡️ Sensor",
+		"a=b?c#d/e",
+	}
+	for _, name := range names {
+		err := s.AddNode("foo", "switch", "", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(rawQueries) != len(names) {
+		t.Fatalf("ISY received %d requests; want %d", len(rawQueries), len(names))
+	}
+	for i, name := range names {
+		raw := rawQueries[i]
+		if strings.Contains(raw, "+") {
+			t.Errorf("query for %q contains a literal +: %s", name, raw)
+		}
+
+		// The ISY decodes only percent escapes, so that must be enough to
+		// recover the original name.
+		got, err := url.PathUnescape(strings.TrimPrefix(raw, "name="))
+		if err != nil {
+			t.Errorf("invalid query for %q: %s", name, err)
+			continue
+		}
+		if got != name {
+			t.Errorf("wrong name from query %s\ngot:  %q\nwant: %q", raw, got, name)
+		}
+	}
+}
+
+func TestProfileClientChangeNodeDef(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 3, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.ChangeNodeDef("zone1", "zone_v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_zone1", "change", "zone_v2"},
+			Query:      map[string][]string{},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientRemoveNode(t *testing.T) {
+	s, rep := newURLReporterServer(t)
+
+	err := s.RemoveNode("zone1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/remove",
+	}
+	if got := rep.urls; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientRenameEnableDisable(t *testing.T) {
+	s, rep := newURLReporterServer(t)
+
+	for _, err := range []error{
+		s.RenameNode("zone1", "Living Room"),
+		s.RenameNode("zone1", "Fan + Light & 50%"),
+		s.EnableNode("zone1"),
+		s.DisableNode("zone1"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/rename?name=Living%20Room",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/rename?name=Fan%20%2B%20Light%20%26%2050%25",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/enable",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/disable",
+	}
+	if got := rep.urls; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientAddNodeExists(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/n001_dup/"):
+			http.Error(w, "node exists", http.StatusConflict)
+		case strings.Contains(r.URL.Path, "/n001_bad/"):
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(&Config{
+		Logger: &testLogger{},
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddNode("new", "switch", "", "New"); err != nil {
+		t.Errorf("wrong error for new node: %v", err)
+	}
+	if err := s.AddNode("dup", "switch", "", "Dup"); err != ErrNodeExists {
+		t.Errorf("wrong error for existing node: %v; want ErrNodeExists", err)
+	}
+	if err := s.AddNode("bad", "switch", "", "Bad"); err == nil || err == ErrNodeExists {
+		t.Errorf("wrong error for other failure: %v", err)
+	}
+}
+
+func TestProfileClientAddDevice(t *testing.T) {
+	s, rep := newURLReporterServer(t)
+
+	err := s.AddDevice(
+		NodeSpec{Addr: "hub", NodeDefID: "hub", Name: "Hub & Bridge", Hint: "0x01020000"},
+		[]NodeSpec{
+			{Addr: "zone1", NodeDefID: "zone", Name: "Zone 1"},
+			{Addr: "zone2", NodeDefID: "zone", Name: "Zone 2 (50%)"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"http://127.0.0.1/rest/ns/1/nodes/n001_hub/add/hub?hint=0x01020000&name=Hub%20%26%20Bridge",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone1/add/zone?name=Zone%201&primary=n001_hub",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_zone2/add/zone?name=Zone%202%20%2850%25%29&primary=n001_hub",
+	}
+	if got := rep.urls; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientAddDeviceInvalid(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Primary     NodeSpec
+		Secondaries []NodeSpec
+	}{
+		{
+			"invalid primary",
+			NodeSpec{Addr: "Hub", NodeDefID: "hub"},
+			[]NodeSpec{{Addr: "zone1", NodeDefID: "zone"}},
+		},
+		{
+			"invalid secondary",
+			NodeSpec{Addr: "hub", NodeDefID: "hub"},
+			[]NodeSpec{{Addr: "zone1", NodeDefID: "zone"}, {Addr: "zone.2", NodeDefID: "zone"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			s, rep := newURLReporterServer(t)
+			err := s.AddDevice(test.Primary, test.Secondaries)
+			if err == nil {
+				t.Fatal("invalid address was accepted")
+			}
+			// Nothing is added if any of the specs is invalid.
+			if len(rep.urls) != 0 {
+				t.Errorf("made %d reports; want none", len(rep.urls))
+			}
+		})
+	}
+}
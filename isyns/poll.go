@@ -0,0 +1,103 @@
+package isyns
+
+import (
+	"time"
+)
+
+// PollRequest is produced by the server itself, rather than by the ISY, at
+// the short and long poll intervals set with Config.ShortPoll and
+// Config.LongPoll or SetPollIntervals. A node server would typically
+// refresh the state of its devices in response, with the long poll being
+// used for less urgent work.
+//
+// PollRequest has no ID, so Complete does nothing. Shutdown does not wait
+// for a poll being handled by Config.Handler, but does cancel its context.
+//
+// The server does not read poll intervals from the ISY, so a program that
+// wants to follow the intervals the user configured must supply them.
+type PollRequest struct {
+	request
+
+	// Long is set for the long poll, and unset for the short poll.
+	Long bool
+}
+
+// SetPollIntervals changes the intervals at which PollRequests are
+// produced, such as to follow the intervals configured on the ISY. An
+// interval of zero disables the corresponding poll.
+//
+// Polls are not produced after the server begins shutting down.
+func (s *Server) SetPollIntervals(short, long time.Duration) {
+	s.pollMu.Lock()
+	defer s.pollMu.Unlock()
+
+	if s.stopPoll != nil {
+		close(s.stopPoll)
+	}
+	stop := make(chan struct{})
+	s.stopPoll = stop
+
+	if short > 0 {
+		go s.poll(short, false, stop)
+	}
+	if long > 0 {
+		go s.poll(long, true, stop)
+	}
+}
+
+func (s *Server) poll(interval time.Duration, long bool, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		case <-s.baseCtx.Done():
+			return
+		}
+
+		req := &PollRequest{
+			request: request{
+				server:  s,
+				profile: s.ProfileClient,
+				ctx:     s.baseCtx,
+				at:      s.now(),
+			},
+			Long: long,
+		}
+		s.deliverPoll(req, stop)
+	}
+}
+
+// deliverPoll delivers a poll request in the same way as requests from the
+// ISY, except that a poll is silently dropped if it can't be delivered.
+//
+// A poll passed to the handler is not counted as in flight, since there is
+// no response to wait for and a slow handler would otherwise hold up
+// Shutdown indefinitely.
+func (s *Server) deliverPoll(req *PollRequest, stop <-chan struct{}) {
+	s.mu.Lock()
+	if s.shuttingDown || s.isRejecting() {
+		s.mu.Unlock()
+		return
+	}
+	if s.reqHandler != nil {
+		s.mu.Unlock()
+		dispatch(s.reqHandler, req)
+		return
+	}
+	s.inFlight.Add(1)
+	s.senders.Add(1)
+	s.mu.Unlock()
+	defer s.inFlight.Done()
+	defer s.senders.Done()
+
+	select {
+	case s.rawReqs <- req:
+	case <-s.abandon:
+	case <-s.rejecting:
+	case <-stop:
+	}
+}
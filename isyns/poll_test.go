@@ -0,0 +1,107 @@
+package isyns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestServerPoll(t *testing.T) {
+	s, err := NewServer(&Config{
+		ShortPoll: time.Millisecond,
+		LongPoll:  time.Hour,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case req := <-s.Requests:
+			poll, ok := req.(*PollRequest)
+			if !ok {
+				t.Fatalf("got %T; want *PollRequest", req)
+			}
+			if poll.Long {
+				t.Errorf("got long poll; want short poll")
+			}
+			if poll.ProfileNum() != 1 {
+				t.Errorf("wrong profile number %d", poll.ProfileNum())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for poll")
+		}
+	}
+
+	s.SetPollIntervals(0, 0)
+
+	// Allow for a poll that was already being delivered when we stopped.
+	select {
+	case <-s.Requests:
+	case <-time.After(20 * time.Millisecond):
+	}
+	select {
+	case req := <-s.Requests:
+		t.Fatalf("got %T after polling was disabled", req)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// slowPollHandler blocks in HandlePoll until the poll's context is
+// cancelled.
+type slowPollHandler struct {
+	BaseHandler
+	polled chan struct{}
+	done   chan error
+}
+
+func (h *slowPollHandler) HandlePoll(req *PollRequest) {
+	select {
+	case h.polled <- struct{}{}:
+	default:
+	}
+	<-req.Context().Done()
+	select {
+	case h.done <- req.Context().Err():
+	default:
+	}
+}
+
+func TestServerShutdownSlowPoll(t *testing.T) {
+	h := &slowPollHandler{
+		polled: make(chan struct{}),
+		done:   make(chan error, 1),
+	}
+	s, err := NewServer(&Config{
+		Handler:   h,
+		ShortPoll: time.Millisecond,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-h.polled
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown waited for a slow poll handler")
+	}
+
+	select {
+	case err := <-h.done:
+		if err != context.Canceled {
+			t.Errorf("wrong context error %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("poll context was not cancelled by Shutdown")
+	}
+}
@@ -0,0 +1,196 @@
+package isyns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/apparentlymart/go-isy/isy"
+	"github.com/apparentlymart/go-isy/profile"
+)
+
+// ProfileClient sends reports to the ISY on behalf of one of the profiles
+// served by a Server.
+//
+// Node addresses given to the methods of ProfileClient are relative to the
+// profile, and are automatically given the prefix the ISY expects.
+//
+// The methods of ProfileClient are safe for concurrent use by multiple
+// goroutines, provided that any Reporter, Metrics, Logger and
+// isy.CredentialsFunc configured for the server are too.
+type ProfileClient struct {
+	num       int
+	server    *Server
+	client    *nsClient
+	isyClient isy.Client
+}
+
+// ProfileNum returns the profile number this client reports for.
+func (p *ProfileClient) ProfileNum() int {
+	return p.num
+}
+
+// ReportBaseURL returns the base URL of the ISY's REST API for this
+// profile, under which all reports are sent. Modifying the result does not
+// affect the client.
+func (p *ProfileClient) ReportBaseURL() *url.URL {
+	u := *p.client.BaseURL
+	return &u
+}
+
+// AddrPrefix returns the prefix the ISY expects on the addresses of this
+// profile's nodes, such as "n001_".
+func (p *ProfileClient) AddrPrefix() string {
+	return p.client.AddrPrefix
+}
+
+// FormatAddr returns the absolute form of the given node address, as used
+// by the ISY, by adding the profile's prefix.
+func (p *ProfileClient) FormatAddr(addr string) string {
+	return p.client.FormatAddr(addr)
+}
+
+// ParseAddr is the inverse of FormatAddr, returning the address relative to
+// the profile. The result is false if the given address does not belong to
+// this profile.
+func (p *ProfileClient) ParseAddr(addr string) (string, bool) {
+	return p.client.ParseAddr(addr)
+}
+
+// AddNode asks the ISY to add a node with the given address and node
+// definition. If the ISY already has a node with the same address then
+// the result is ErrNodeExists. An address that the ISY would not accept is
+// reported as an error without contacting the ISY; see ValidateNodeAddr.
+//
+// AddNodeWithOptions allows additional settings to be given.
+func (p *ProfileClient) AddNode(addr, defId, primaryAddr, name string) error {
+	return p.AddNodeWithOptions(AddNodeOptions{
+		Addr:      addr,
+		NodeDefID: defId,
+		Primary:   primaryAddr,
+		Name:      name,
+	})
+}
+
+// AddNodeContext is like AddNode but gives up when the given context is
+// cancelled or its deadline passes.
+func (p *ProfileClient) AddNodeContext(ctx context.Context, addr, defId, primaryAddr, name string) error {
+	return p.AddNodeWithOptionsContext(ctx, AddNodeOptions{
+		Addr:      addr,
+		NodeDefID: defId,
+		Primary:   primaryAddr,
+		Name:      name,
+	})
+}
+
+// AddNodeWithOptions is like AddNode but takes its arguments as an
+// AddNodeOptions, allowing optional settings to be omitted.
+func (p *ProfileClient) AddNodeWithOptions(opts AddNodeOptions) error {
+	return p.client.AddNode(opts)
+}
+
+// AddNodeWithOptionsContext is like AddNodeWithOptions but gives up when the
+// given context is cancelled or its deadline passes.
+func (p *ProfileClient) AddNodeWithOptionsContext(ctx context.Context, opts AddNodeOptions) error {
+	return p.client.AddNodeContext(ctx, opts)
+}
+
+// RemoveNode asks the ISY to remove the node with the given address, such as
+// when the device it represents no longer exists.
+func (p *ProfileClient) RemoveNode(addr string) error {
+	return p.client.RemoveNode(addr)
+}
+
+// ChangeNodeDef asks the ISY to change the node definition of the node with
+// the given address, such as when the device it represents has gained new
+// capabilities. Unlike removing and re-adding the node, this preserves any
+// references to the node in the ISY's programs and scenes.
+func (p *ProfileClient) ChangeNodeDef(addr, defId string) error {
+	return p.client.ChangeNodeDef(addr, defId)
+}
+
+// RenameNode asks the ISY to change the display name of the node with the
+// given address.
+func (p *ProfileClient) RenameNode(addr, name string) error {
+	return p.client.RenameNode(addr, name)
+}
+
+// EnableNode asks the ISY to mark the node with the given address as
+// enabled.
+func (p *ProfileClient) EnableNode(addr string) error {
+	return p.client.SetNodeEnabled(addr, true)
+}
+
+// DisableNode asks the ISY to mark the node with the given address as
+// disabled.
+func (p *ProfileClient) DisableNode(addr string) error {
+	return p.client.SetNodeEnabled(addr, false)
+}
+
+// SetDriver reports the current value of a driver on the given node to the
+// ISY. If uom is UOMUnknown then the unit is omitted from the report.
+func (p *ProfileClient) SetDriver(addr, driver, value string, uom isy.UOM) error {
+	return p.client.SetDriver(addr, driver, value, uom, 0, false)
+}
+
+// SetDriverForce is like SetDriver but asks the ISY to accept the value even
+// if it is the same as the value the ISY already has, which it would
+// otherwise ignore. This is useful for re-asserting all values after the
+// node server restarts.
+func (p *ProfileClient) SetDriverForce(addr, driver, value string, uom isy.UOM) error {
+	return p.client.SetDriver(addr, driver, value, uom, 0, true)
+}
+
+// ReportCommand notifies the ISY that a command was initiated by a device
+// itself, such as when a switch is toggled locally. param may be nil for
+// commands that have no value, and its UOM may be UOMUnknown to omit the unit.
+func (p *ProfileClient) ReportCommand(addr, command string, param *CommandParam) error {
+	return p.client.ReportCommand(addr, command, param)
+}
+
+// UploadProfile uploads the given profile to the ISY and then asks the ISY
+// to reload it, so that nodes of the types it defines can be added. The
+// profile is validated first, and nothing is uploaded if it is invalid.
+func (p *ProfileClient) UploadProfile(prof *profile.Profile) error {
+	var buf bytes.Buffer
+	err := prof.WriteZip(&buf)
+	if err != nil {
+		return err
+	}
+
+	err = p.isyClient.UploadProfileContext(p.client.ctx, p.num, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to upload profile: %s", err)
+	}
+	err = p.isyClient.ReloadProfileContext(p.client.ctx, p.num)
+	if err != nil {
+		return fmt.Errorf("failed to reload profile: %s", err)
+	}
+	return nil
+}
+
+// SetCustomParams replaces the set of user-editable custom configuration
+// parameters the ISY stores on behalf of the node server. Users can then
+// change these in the ISY admin console, which results in a
+// CustomParamsRequest.
+func (p *ProfileClient) SetCustomParams(params map[string]string) error {
+	return p.client.SetCustomParams(params)
+}
+
+// AddNotice posts a notice to be shown to the user in the ISY admin
+// console, replacing any existing notice with the same key.
+func (p *ProfileClient) AddNotice(key, text string) error {
+	return p.client.AddNotice(key, text)
+}
+
+// RemoveNotice removes a notice previously posted with AddNotice.
+func (p *ProfileClient) RemoveNotice(key string) error {
+	return p.client.RemoveNotice(key)
+}
+
+// ReportNodeStatus is an older form of SetDriver that always includes the
+// unit in the report, even if it is UOMUnknown.
+func (p *ProfileClient) ReportNodeStatus(addr, field, value string, uom isy.UOM) error {
+	return p.client.ReportNodeStatus(addr, field, value, uom)
+}
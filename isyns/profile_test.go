@@ -0,0 +1,104 @@
+package isyns
+
+import (
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+// urlReporter is a Reporter that records the full URL of each report, for
+// tests that need to check how its parts are escaped.
+type urlReporter struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (r *urlReporter) Report(u *url.URL) error {
+	r.mu.Lock()
+	r.urls = append(r.urls, u.String())
+	r.mu.Unlock()
+	return nil
+}
+
+func newURLReporterServer(t *testing.T) (*Server, *urlReporter) {
+	rep := &urlReporter{}
+	s, err := NewServer(&Config{
+		Reporter: rep,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, rep
+}
+
+func TestProfileClientReportCommand(t *testing.T) {
+	s, rep := newURLReporterServer(t)
+
+	for _, err := range []error{
+		s.ReportCommand("sw", "DON", nil),
+		s.ReportCommand("sw", "DON", &CommandParam{Value: "50"}),
+		s.ReportCommand("sw", "DON", &CommandParam{Value: "50", UOM: isy.UOMPercent}),
+		s.ReportCommand("sw", "SET", &CommandParam{Value: "a/b c"}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"http://127.0.0.1/rest/ns/1/nodes/n001_sw/report/cmd/DON",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_sw/report/cmd/DON/50",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_sw/report/cmd/DON/50/51",
+		"http://127.0.0.1/rest/ns/1/nodes/n001_sw/report/cmd/SET/a%2Fb%20c",
+	}
+	if got := rep.urls; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientSetCustomParams(t *testing.T) {
+	s, rep := newURLReporterServer(t)
+
+	err := s.SetCustomParams(map[string]string{
+		"host": "192.168.1.20",
+		"name": "Living Room",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"http://127.0.0.1/rest/ns/1/set/customparams?host=192.168.1.20&name=Living%20Room",
+	}
+	if got := rep.urls; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestProfileClientNotices(t *testing.T) {
+	s, rep := newURLReporterServer(t)
+
+	for _, err := range []error{
+		s.AddNotice("hub", "Please re-pair your hub"),
+		s.AddNotice("zone 1/2", "Zone unreachable"),
+		s.RemoveNotice("hub"),
+		s.RemoveNotice("zone 1/2"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"http://127.0.0.1/rest/ns/1/notices/hub/add?text=Please%20re-pair%20your%20hub",
+		"http://127.0.0.1/rest/ns/1/notices/zone%201%2F2/add?text=Zone%20unreachable",
+		"http://127.0.0.1/rest/ns/1/notices/hub/remove",
+		"http://127.0.0.1/rest/ns/1/notices/zone%201%2F2/remove",
+	}
+	if got := rep.urls; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
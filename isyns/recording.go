@@ -0,0 +1,91 @@
+package isyns
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Reporter is the interface used to deliver reports to the ISY. Each report
+// is an absolute URL under the ISY's node server REST API.
+//
+// By default a Server delivers reports by making HTTP requests to the ISY,
+// but a different Reporter may be set in Config, such as a RecordingClient
+// for testing.
+type Reporter interface {
+	Report(u *url.URL) error
+}
+
+// RecordingClient is a Reporter that records reports in memory instead of
+// sending them, allowing tests to make assertions about what a node server
+// would have reported to the ISY. It is safe for concurrent use.
+type RecordingClient struct {
+	mu    sync.Mutex
+	calls []RecordedCall
+}
+
+// RecordedCall is a single report recorded by a RecordingClient.
+type RecordedCall struct {
+	// ProfileNum is the profile the report was sent for.
+	ProfileNum int
+
+	// Parts are the path segments of the report relative to the profile's
+	// base URL, such as []string{"nodes", "n001_foo", "report", "status",
+	// "ST", "100", "51"}.
+	Parts []string
+
+	// Query holds any query string arguments sent with the report.
+	Query url.Values
+}
+
+// NewRecordingClient creates a new, empty RecordingClient.
+func NewRecordingClient() *RecordingClient {
+	return &RecordingClient{}
+}
+
+func (c *RecordingClient) Report(u *url.URL) error {
+	call := RecordedCall{
+		Query: u.Query(),
+	}
+
+	// We split the escaped path so that any escaped slashes within
+	// individual segments are preserved.
+	path := u.EscapedPath()
+	if idx := strings.Index(path, "/rest/ns/"); idx != -1 {
+		path = path[idx+len("/rest/ns/"):]
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 0 {
+		if num, err := strconv.Atoi(parts[0]); err == nil {
+			call.ProfileNum = num
+			parts = parts[1:]
+		}
+	}
+	for i, part := range parts {
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			parts[i] = unescaped
+		}
+	}
+	call.Parts = parts
+
+	c.mu.Lock()
+	c.calls = append(c.calls, call)
+	c.mu.Unlock()
+	return nil
+}
+
+// Calls returns all of the reports recorded so far, in the order they were
+// made.
+func (c *RecordingClient) Calls() []RecordedCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]RecordedCall(nil), c.calls...)
+}
+
+// Reset discards all of the recorded reports.
+func (c *RecordingClient) Reset() {
+	c.mu.Lock()
+	c.calls = nil
+	c.mu.Unlock()
+}
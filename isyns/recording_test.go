@@ -0,0 +1,54 @@
+package isyns
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestRecordingClient(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 3, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SetDriver("foo bar", "ST", "100", isy.UOMPercent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddNode("baz", "thermostat", "", "Thermostat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetDriverForce("baz", "ST", "72", isy.UOMFahrenheit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_foo bar", "report", "status", "ST", "100", "51"},
+			Query:      map[string][]string{},
+		},
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_baz", "add", "thermostat"},
+			Query:      map[string][]string{"name": {"Thermostat"}},
+		},
+		{
+			ProfileNum: 3,
+			Parts:      []string{"nodes", "n003_baz", "report", "status", "ST", "72", "17"},
+			Query:      map[string][]string{"force": {"true"}},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
@@ -1,28 +1,134 @@
 package isyns
 
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/apparentlymart/go-isy/profile"
+)
+
 type Request interface {
 	ID() string
 	Complete(success bool) error
 	Server() *Server
+
+	// CompleteContext is like Complete but gives up on reporting the
+	// result to the ISY, including any retries, when the given context is
+	// cancelled or its deadline passes.
+	CompleteContext(ctx context.Context, success bool) error
+
+	// ProfileNum and Profile identify the profile that the request relates
+	// to, for servers that serve more than one profile. Reports about the
+	// request's nodes should be sent using the returned ProfileClient.
+	ProfileNum() int
+	Profile() *ProfileClient
+
+	// Context returns a context that is cancelled when the server shuts
+	// down, which can be used to abandon long-running work for a request.
+	// It is not cancelled when the ISY's connection closes, since the ISY
+	// expects each request to be handled after it has been acknowledged.
+	Context() context.Context
+
+	// ReceivedAt returns the time at which the request arrived from the
+	// ISY, and Age returns how long ago that was.
+	ReceivedAt() time.Time
+	Age() time.Duration
+
+	// RawQuery and Header return copies of the query string arguments and
+	// HTTP headers of the request as originally sent by the ISY, for
+	// debugging purposes.
+	RawQuery() url.Values
+	Header() http.Header
+
+	// ClientCertificate returns the verified TLS client certificate that
+	// the ISY presented with the request, or nil if there was none. Its
+	// Subject can be used to decide whether to authorize the request.
+	ClientCertificate() *x509.Certificate
+
 	requestSigil() request
 }
 
+// InstallRequest is sent when the ISY installs the node server into one of
+// its profile slots. The profile number being installed, taken from the
+// request URL, is returned by the ProfileNum method.
 type InstallRequest struct {
 	request
 }
 
+// Install performs the usual sequence of steps for installing the node
+// server: it uploads the given profile with UploadProfile, adds the given
+// nodes with SyncNodes, and then completes the request, reporting success
+// only if all of the steps succeeded. nodes may be empty if the node server
+// adds its nodes later, such as after discovering devices.
+func (r *InstallRequest) Install(prof *profile.Profile, nodes []NodeSpec) error {
+	err := r.profile.UploadProfile(prof)
+	if err == nil && len(nodes) > 0 {
+		err = r.profile.SyncNodes(nodes, false)
+	}
+	completeErr := r.Complete(err == nil)
+	if err != nil {
+		return err
+	}
+	return completeErr
+}
+
 type NodeQueryRequest struct {
 	request
 	NodeAddr string
 }
 
+// Respond reports the given driver values for the queried node and then
+// completes the request, reporting success only if all of the values were
+// reported successfully.
+func (r *NodeQueryRequest) Respond(values []DriverValue) error {
+	err := r.profile.SetDrivers(r.NodeAddr, values)
+	completeErr := r.Complete(err == nil)
+	if err != nil {
+		return err
+	}
+	return completeErr
+}
+
 type NodeStatusValuesRequest struct {
 	request
 	NodeAddr string
 }
 
+// Report reports the given driver values for the node and then completes
+// the request, reporting success only if all of the values were reported
+// successfully.
+func (r *NodeStatusValuesRequest) Report(values []DriverValue) error {
+	err := r.profile.SetDrivers(r.NodeAddr, values)
+	completeErr := r.Complete(err == nil)
+	if err != nil {
+		return err
+	}
+	return completeErr
+}
+
+// AddAllNodesRequest is sent when the ISY wants the node server to add all
+// of its nodes, such as after the ISY has been restored from a backup.
 type AddAllNodesRequest struct {
 	request
+
+	// Discover is set if the user asked the node server to discover new
+	// devices, rather than only to re-add the nodes it already knows of.
+	// A node server might use this as a cue to do a more expensive scan.
+	Discover bool
+}
+
+// Sync brings the ISY's nodes for the profile into line with the given
+// nodes using SyncNodes, and then completes the request.
+func (r *AddAllNodesRequest) Sync(nodes []NodeSpec, removeExtra bool) error {
+	err := r.profile.SyncNodes(nodes, removeExtra)
+	completeErr := r.Complete(err == nil)
+	if err != nil {
+		return err
+	}
+	return completeErr
 }
 
 type AddNodeRequest struct {
@@ -58,9 +164,24 @@ type CommandRequest struct {
 	Params   map[string]CommandParam
 }
 
+// CustomParamsRequest is sent when the user changes the node server's
+// custom configuration parameters on the ISY. Params contains the complete
+// new set of parameters, decoded from the JSON object in the request body
+// along with any given in the query string.
+type CustomParamsRequest struct {
+	request
+	Params map[string]string
+}
+
 type request struct {
-	id     string
-	server *Server
+	id      string
+	server  *Server
+	profile *ProfileClient
+	ctx     context.Context
+	query   url.Values
+	header  http.Header
+	cert    *x509.Certificate
+	at      time.Time
 }
 
 func (r request) ID() string {
@@ -68,17 +189,86 @@ func (r request) ID() string {
 }
 
 func (r request) Complete(success bool) error {
+	return r.CompleteContext(context.Background(), success)
+}
+
+func (r request) CompleteContext(ctx context.Context, success bool) error {
 	if r.id == "" {
 		return nil
 	}
+	if r.server != nil && !r.server.finish(r.id, success) {
+		r.server.logger.Printf("warning: request %s was completed after its failure was already reported", r.id)
+		return nil
+	}
 
-	return r.server.client.ReportRequestStatus(r.id, success)
+	return r.profile.client.ReportRequestStatusContext(ctx, r.id, success)
 }
 
 func (r request) Server() *Server {
 	return r.server
 }
 
+func (r request) ProfileNum() int {
+	return r.profile.num
+}
+
+func (r request) Profile() *ProfileClient {
+	return r.profile
+}
+
+func (r request) Context() context.Context {
+	return r.ctx
+}
+
+func (r request) ReceivedAt() time.Time {
+	return r.at
+}
+
+func (r request) Age() time.Duration {
+	return r.server.now().Sub(r.at)
+}
+
+func (r request) RawQuery() url.Values {
+	ret := make(url.Values, len(r.query))
+	for k, vs := range r.query {
+		ret[k] = append([]string(nil), vs...)
+	}
+	return ret
+}
+
+func (r request) Header() http.Header {
+	return r.header.Clone()
+}
+
+func (r request) ClientCertificate() *x509.Certificate {
+	return r.cert
+}
+
 func (r request) requestSigil() request {
 	return r
 }
+
+// isDeviceRequest returns true if the given request can only be handled by
+// communicating with the devices the node server represents. See
+// Server.SetReady.
+func isDeviceRequest(req Request) bool {
+	switch req.(type) {
+	case *NodeQueryRequest, *NodeStatusValuesRequest, *CommandRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// isMutatingRequest returns true if the given request asks the node server
+// to change something, as opposed to just reporting its current state.
+func isMutatingRequest(req Request) bool {
+	switch req.(type) {
+	case *AddAllNodesRequest, *AddNodeRequest, *RemoveNodeRequest,
+		*RenameNodeRequest, *EnableNodeRequest, *CommandRequest,
+		*CustomParamsRequest:
+		return true
+	default:
+		return false
+	}
+}
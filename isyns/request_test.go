@@ -0,0 +1,396 @@
+package isyns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+	"github.com/apparentlymart/go-isy/profile"
+)
+
+func TestNodeStatusValuesRequestReport(t *testing.T) {
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 2, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &NodeStatusValuesRequest{
+		request: request{
+			id:      "7",
+			server:  s,
+			profile: s.ProfileClient,
+		},
+		NodeAddr: "tstat",
+	}
+	err = req.Report([]DriverValue{
+		{Driver: "ST", Value: "72", UOM: isy.UOMFahrenheit},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{
+			ProfileNum: 2,
+			Parts:      []string{"nodes", "n002_tstat", "report", "status", "ST", "72", "17"},
+			Query:      map[string][]string{},
+		},
+		{
+			ProfileNum: 2,
+			Parts:      []string{"report", "status", "7", "success"},
+			Query:      map[string][]string{},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, args ...interface{}) {
+	l.Debugf(format, args...)
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func TestNodeQueryRequestRespond(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Failures int
+		WantErr  bool
+		Want     []RecordedCall
+	}{
+		{
+			"success",
+			0,
+			false,
+			[]RecordedCall{
+				{
+					ProfileNum: 1,
+					Parts:      []string{"nodes", "n001_sw", "report", "status", "ST", "100", "51"},
+					Query:      map[string][]string{},
+				},
+				{
+					ProfileNum: 1,
+					Parts:      []string{"report", "status", "9", "success"},
+					Query:      map[string][]string{},
+				},
+			},
+		},
+		{
+			// The driver report fails, so the request is reported as failed.
+			"failure",
+			1,
+			true,
+			[]RecordedCall{
+				{
+					ProfileNum: 1,
+					Parts:      []string{"report", "status", "9", "fail"},
+					Query:      map[string][]string{},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			rec := &flakyReporter{RecordingClient: NewRecordingClient(), failures: test.Failures}
+			s, err := NewServer(&Config{
+				Reporter: rec,
+				Logger:   &testLogger{},
+			}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := &NodeQueryRequest{
+				request: request{
+					id:      "9",
+					server:  s,
+					profile: s.ProfileClient,
+				},
+				NodeAddr: "sw",
+			}
+			err = req.Respond([]DriverValue{
+				{Driver: "ST", Value: "100", UOM: isy.UOMPercent},
+			})
+			if (err != nil) != test.WantErr {
+				t.Errorf("wrong result\ngot error: %v\nwant error: %t", err, test.WantErr)
+			}
+			if got := rec.Calls(); !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("wrong reports\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestRequestCompleteLogsRequestID(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	logger := &testLogger{}
+	s, err := NewServer(&Config{
+		Logger: logger,
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &CommandRequest{
+		request: request{
+			id:      "42",
+			server:  s,
+			profile: s.ProfileClient,
+		},
+		NodeAddr: "foo",
+	}
+	err = req.Complete(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetDriver("foo", "ST", "1", isy.UOMBoolean)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET " + ts.URL + "/rest/ns/1/report/status/42/success [requestId=42] -> 200 OK",
+		"GET " + ts.URL + "/rest/ns/1/nodes/n001_foo/report/status/ST/1/2 [node=n001_foo driver=ST] -> 200 OK",
+	}
+	if !reflect.DeepEqual(logger.lines, want) {
+		t.Errorf("wrong log output\ngot:  %#v\nwant: %#v", logger.lines, want)
+	}
+}
+
+func TestRequestCompleteContext(t *testing.T) {
+	unblock := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer ts.Close()
+	defer close(unblock)
+
+	s, err := NewServer(&Config{
+		Logger: &testLogger{},
+		Retry: RetryPolicy{
+			MaxAttempts: 5,
+			BaseDelay:   time.Second,
+		},
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &CommandRequest{
+		request: request{
+			id:      "42",
+			server:  s,
+			profile: s.ProfileClient,
+		},
+		NodeAddr: "foo",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = req.CompleteContext(ctx, true)
+	if err == nil {
+		t.Fatal("CompleteContext succeeded; want error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CompleteContext took %s; should have given up at the deadline", elapsed)
+	}
+}
+
+func TestInstallRequestInstall(t *testing.T) {
+	var mu sync.Mutex
+	var isyReqs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		isyReqs = append(isyReqs, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/rest/nodes":
+			w.Write([]byte(`<nodes></nodes>`))
+		default:
+			w.Write([]byte(`<RestResponse succeeded="true"><status>200</status></RestResponse>`))
+		}
+	}))
+	defer ts.Close()
+
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Reporter: rec,
+	}, 2, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &InstallRequest{
+		request: request{
+			id:      "5",
+			server:  s,
+			profile: s.ProfileClient,
+		},
+	}
+	prof := &profile.Profile{
+		NodeDefs: []*profile.NodeDef{{ID: "hub"}},
+		NLS:      profile.NLS{},
+	}
+	err = req.Install(prof, []NodeSpec{{Addr: "hub", NodeDefID: "hub", Name: "Hub"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantISY := []string{
+		"POST /rest/ns/profile/2/upload/zip/profile.zip",
+		"GET /rest/ns/profile/2/reload",
+		"GET /rest/nodes",
+	}
+	if !reflect.DeepEqual(isyReqs, wantISY) {
+		t.Errorf("wrong ISY requests\ngot:  %#v\nwant: %#v", isyReqs, wantISY)
+	}
+
+	got := rec.Calls()
+	want := []RecordedCall{
+		{
+			ProfileNum: 2,
+			Parts:      []string{"nodes", "n002_hub", "add", "hub"},
+			Query:      url.Values{"name": {"Hub"}},
+		},
+		{
+			ProfileNum: 2,
+			Parts:      []string{"report", "status", "5", "success"},
+			Query:      url.Values{},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong reports\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestRequestRawQueryAndHeader(t *testing.T) {
+	s, err := NewServer(&Config{
+		RequestBufferSize: 1,
+		Reporter:          NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/ns/nodes/n001_sw/cmd/DON?requestId=4&level.uom51=50&note=a%20b&note=c", nil)
+	r.SetBasicAuth("", "")
+	r.Header.Set("X-Firmware", "5.3.4")
+	s.ServeHTTP(httptest.NewRecorder(), r)
+	req := <-s.Requests
+
+	wantQuery := url.Values{
+		"requestId":   {"4"},
+		"level.uom51": {"50"},
+		"note":        {"a b", "c"},
+	}
+	if got := req.RawQuery(); !reflect.DeepEqual(got, wantQuery) {
+		t.Errorf("wrong query\ngot:  %#v\nwant: %#v", got, wantQuery)
+	}
+	if got, want := req.Header().Get("X-Firmware"), "5.3.4"; got != want {
+		t.Errorf("wrong X-Firmware header %q; want %q", got, want)
+	}
+
+	// The results are copies, so modifying them must not affect the request.
+	req.RawQuery()["note"][0] = "changed"
+	req.Header().Set("X-Firmware", "changed")
+	if got := req.RawQuery(); !reflect.DeepEqual(got, wantQuery) {
+		t.Errorf("query was modified\ngot:  %#v\nwant: %#v", got, wantQuery)
+	}
+	if got, want := req.Header().Get("X-Firmware"), "5.3.4"; got != want {
+		t.Errorf("header was modified to %q", got)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	s, err := NewServer(&Config{
+		RequestBufferSize: 1,
+		Reporter:          NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpCtx, disconnect := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/ns/nodes/n001_sw/query?requestId=1", nil).WithContext(httpCtx)
+	r.SetBasicAuth("", "")
+	s.ServeHTTP(httptest.NewRecorder(), r)
+	req := <-s.Requests
+
+	// The ISY disconnecting after the request was acknowledged must not
+	// cancel work on the request.
+	disconnect()
+	if err := req.Context().Err(); err != nil {
+		t.Fatalf("request context ended when the ISY disconnected: %s", err)
+	}
+
+	err = s.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-req.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("request context not cancelled by Shutdown")
+	}
+	if got, want := req.Context().Err(), context.Canceled; got != want {
+		t.Errorf("wrong context error %v; want %v", got, want)
+	}
+}
+
+func TestRequestReceivedAtAndAge(t *testing.T) {
+	s, err := NewServer(&Config{
+		RequestBufferSize: 1,
+		Reporter:          NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time { return clock }
+
+	r := httptest.NewRequest("GET", "/ns/nodes/n001_sw/query?requestId=1", nil)
+	r.SetBasicAuth("", "")
+	s.ServeHTTP(httptest.NewRecorder(), r)
+	req := <-s.Requests
+
+	received := clock
+	if got := req.ReceivedAt(); !got.Equal(received) {
+		t.Errorf("wrong ReceivedAt %s; want %s", got, received)
+	}
+	if got := req.Age(); got != 0 {
+		t.Errorf("wrong initial Age %s; want 0", got)
+	}
+
+	clock = clock.Add(90 * time.Second)
+	if got, want := req.Age(), 90*time.Second; got != want {
+		t.Errorf("wrong Age %s; want %s", got, want)
+	}
+	if got := req.ReceivedAt(); !got.Equal(received) {
+		t.Errorf("ReceivedAt changed to %s; want %s", got, received)
+	}
+}
@@ -0,0 +1,78 @@
+package isyns
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+// RetryPolicy controls how reports to the ISY are retried after a transient
+// failure, which is either a connection error or a 5xx response status.
+// All reports are idempotent GET requests, so retrying is always safe.
+//
+// The zero value disables retrying.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made for each report,
+	// including the first. Values less than two disable retrying.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, which is then doubled
+	// for each subsequent retry up to MaxDelay, if set.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is the fraction, between zero and one, by which each delay is
+	// randomly reduced so that retries from many reports are spread out.
+	Jitter float64
+}
+
+// delay returns how long to wait before the given retry, numbered from one.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// isRetryable returns true if the given error from an HTTP request to the
+// ISY might succeed if the request is repeated. Only 5xx responses and
+// network errors qualify; errors such as a cancelled context, failure to
+// obtain credentials or an invalid URL would just happen again.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr *isy.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 && httpErr.StatusCode != http.StatusNotImplemented
+	}
+
+	// *url.Error is itself a net.Error, so we must look at what it wraps
+	// to distinguish a network failure from a problem with the request.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,181 @@
+package isyns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+	}
+
+	tests := []struct {
+		Retry int
+		Want  time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, test := range tests {
+		if got := p.delay(test.Retry); got != test.Want {
+			t.Errorf("wrong delay for retry %d\ngot:  %s\nwant: %s", test.Retry, got, test.Want)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		Name string
+		Err  error
+		Want bool
+	}{
+		{"nil", nil, false},
+		{"server error", &isy.HTTPError{StatusCode: 503}, true},
+		{"not implemented", &isy.HTTPError{StatusCode: 501}, false},
+		{"client error", &isy.HTTPError{StatusCode: 404}, false},
+		{
+			"connection refused",
+			&url.Error{Op: "Get", URL: "http://isy/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}},
+			true,
+		},
+		{
+			"timeout",
+			&url.Error{Op: "Get", URL: "http://isy/", Err: &net.DNSError{Err: "timeout", Name: "isy", IsTimeout: true}},
+			true,
+		},
+		{"bare network error", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}, true},
+		{
+			"cancelled",
+			&url.Error{Op: "Get", URL: "http://isy/", Err: context.Canceled},
+			false,
+		},
+		{
+			"deadline",
+			&url.Error{Op: "Get", URL: "http://isy/", Err: context.DeadlineExceeded},
+			false,
+		},
+		{"bare cancelled", context.Canceled, false},
+		{
+			"invalid URL",
+			&url.Error{Op: "Get", URL: "foo://isy/", Err: errors.New(`unsupported protocol scheme "foo"`)},
+			false,
+		},
+		{"credentials", errors.New("failed to obtain ISY credentials: vault sealed"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if got := isRetryable(test.Err); got != test.Want {
+				t.Errorf("wrong result for %#v: %t; want %t", test.Err, got, test.Want)
+			}
+		})
+	}
+}
+
+func TestServerReportRetry(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Statuses []int
+		WantErr  bool
+		WantReqs int32
+	}{
+		{"success", []int{200}, false, 1},
+		{"transient", []int{503, 502, 200}, false, 3},
+		{"exhausted", []int{503, 503, 503, 200}, true, 3},
+		{"client error", []int{404, 200}, true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var reqs int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&reqs, 1)
+				w.WriteHeader(test.Statuses[n-1])
+			}))
+			defer ts.Close()
+
+			s, err := NewServer(&Config{
+				Retry: RetryPolicy{
+					MaxAttempts: 3,
+					BaseDelay:   time.Millisecond,
+				},
+			}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.SetDriver("foo", "ST", "1", isy.UOMBoolean)
+			if (err != nil) != test.WantErr {
+				t.Errorf("wrong result\ngot error: %v\nwant error: %t", err, test.WantErr)
+			}
+			if got := atomic.LoadInt32(&reqs); got != test.WantReqs {
+				t.Errorf("made %d requests; want %d", got, test.WantReqs)
+			}
+		})
+	}
+}
+
+func TestServerReportTransportError(t *testing.T) {
+	// A server that has been closed refuses connections, so the report
+	// fails without any HTTP response at all.
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	s, err := NewServer(&Config{
+		Logger: &testLogger{},
+		Retry:  RetryPolicy{MaxAttempts: 1},
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SetDriver("foo", "ST", "1", isy.UOMBoolean)
+	if err == nil {
+		t.Fatal("report to closed listener succeeded; want error")
+	}
+}
+
+func TestServerReportHTTPError(t *testing.T) {
+	body := strings.Repeat("x", 2000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(&Config{
+		Logger: &testLogger{},
+	}, 1, &isy.ClientConfig{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SetDriver("foo", "ST", "1", isy.UOMBoolean)
+	httpErr, ok := err.(*isy.HTTPError)
+	if !ok {
+		t.Fatalf("wrong error %#v; want *isy.HTTPError", err)
+	}
+	if got, want := httpErr.StatusCode, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status %d; want %d", got, want)
+	}
+	if got, want := httpErr.Body, body[:1024]; got != want {
+		t.Errorf("wrong body of %d bytes; want the first %d bytes of the response", len(got), len(want))
+	}
+}
@@ -1,65 +1,173 @@
 package isyns
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/sha256"
-	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apparentlymart/go-isy/isy"
 	"github.com/gorilla/mux"
 )
 
+// unixSocketMode is the permissions given to the socket created by
+// ListenAndServeUnix, allowing access only to its owner and group.
+const unixSocketMode = 0660
+
+// minProfileNum and maxProfileNum are the range of node server profile
+// numbers supported by the ISY.
+const (
+	minProfileNum = 1
+	maxProfileNum = 25
+)
+
+// ErrNodeExists is returned by AddNode if the ISY already has a node with
+// the given address.
+var ErrNodeExists = errors.New("node already exists")
+
+// defaultISYTimeout is the timeout for requests to the ISY when the
+// isy.ClientConfig passed to NewServer has no HTTPClient.
+const defaultISYTimeout = 30 * time.Second
+
+// timedOutRetention is how long the server remembers that a request was
+// failed for not being completed in time, so that a late completion of it
+// is not reported. Requests whose handlers never complete would otherwise
+// be remembered forever.
+const timedOutRetention = time.Hour
+
 // Server is the main type in this package, representing a single node server.
 //
 // After creating a Server using NewServer, call either ListenAndServe or Serve
 // in a separate goroutine and then read the channel Requests until it is
 // closed, indicating a shutdown.
 //
-//    s, err := isyns.NewServer(config, profileNum, isyConfig)
-//    // (handle possible error in "err")
+//	s, err := isyns.NewServer(config, profileNum, isyConfig)
+//	// (handle possible error in "err")
 //
-//    serverErr := make(chan error)
-//    go func() {
-//        serverErr <- s.ListenAndServe()
-//        close(serverErr)
-//    }()
+//	serverErr := make(chan error)
+//	go func() {
+//	    serverErr <- s.ListenAndServe()
+//	    close(serverErr)
+//	}()
 //
-//    Events:
-//    for {
-//        select {
-//        case err := <-serverErr:
-//            log.Printf("error: %s", err)
-//            break Events
-//        case req, ok := <-s.Requests:
-//            // handle "req" e.g. with a type switch
-//            if !ok {
-//                break Events
-//            }
+//	Events:
+//	for {
+//	    select {
+//	    case err := <-serverErr:
+//	        log.Printf("error: %s", err)
+//	        break Events
+//	    case req, ok := <-s.Requests:
+//	        // handle "req" e.g. with a type switch
+//	        if !ok {
+//	            break Events
+//	        }
 //
-//        // (also handle events for whichever external system the node server is representing)
+//	    // (also handle events for whichever external system the node server is representing)
 //
-//        }
-//    }
-
-var router *mux.Router
-
+//	    }
+//	}
+//
+// If the program stops reading Requests before Shutdown is called, it
+// should call StopAccepting so that the ISY's requests are rejected rather
+// than left waiting.
 type Server struct {
+	// ProfileClient sends reports to the ISY for the profile number given
+	// to NewServer. Use Profile to obtain a ProfileClient for any other
+	// profiles added with AddProfile.
+	*ProfileClient
+
 	Requests       <-chan Request
 	rawReqs        chan Request
-	client         nsClient
 	httpServer     *http.Server
-	username       string
+	adminServer    *http.Server
+	adminHandler   http.Handler
+	router         *mux.Router
+	routeTemplates [][]string
+	usernameSHA256 []byte
 	passwordSHA256 []byte
-	addrPrefix     string
+	digestAuth     bool
+	clientCerts    bool
+	clientCertOnly bool
+	digestHA1      string
+	nonceKey       []byte
+	reqHandler     Handler
+	onUnrecognized func(UnrecognizedRequest)
+	responder      func(Request, http.ResponseWriter) bool
+	logger         Logger
+	metrics        Metrics
+	reporter       Reporter
+	retry          RetryPolicy
+
+	// Used to coordinate draining of requests during Shutdown. inFlight
+	// counts all requests being delivered or handled, while senders counts
+	// only those that may still send to rawReqs.
+	mu           sync.Mutex
+	shuttingDown bool
+	notReady     bool
+	inFlight     sync.WaitGroup
+	senders      sync.WaitGroup
+	abandon      chan struct{}
+
+	// IDs of delivered requests that have not yet been completed, with
+	// the time each was received
+	pendingMu sync.Mutex
+	pending   map[string]time.Time
+
+	// Outcomes of requests completed within the last dedupWindow, also
+	// guarded by pendingMu
+	dedupWindow time.Duration
+	completed   map[string]completedRequest
+
+	// Timers that fail requests not completed within completeTimeout, and
+	// when each request that was failed that way expired, retained for
+	// timedOutRetention; also guarded by pendingMu
+	completeTimeout   time.Duration
+	watchdogs         map[string]*watchdog
+	timedOut          map[string]time.Time
+	timedOutRetention time.Duration
+
+	// Closed by StopAccepting to reject all further requests
+	rejecting     chan struct{}
+	stopAccepting sync.Once
+
+	// Closed to stop the current poll tickers
+	pollMu   sync.Mutex
+	stopPoll chan struct{}
+
+	// Settings used to create a ProfileClient for each profile
+	isyBaseURL     *url.URL
+	isyConfig      isy.ClientConfig
+	isyClient      isy.Client
+	profilesMu     sync.RWMutex
+	profiles       map[int]*ProfileClient
+	profileServers map[int]*http.Server
+
+	// baseCtx is the parent of the contexts of all requests, and is
+	// cancelled once Shutdown completes or times out.
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
+
+	// now returns the current time, and is replaced in tests.
+	now func() time.Time
 }
 
 type Config struct {
@@ -67,17 +175,109 @@ type Config struct {
 	TLSConfig  *tls.Config
 	ErrorLog   *log.Logger
 
+	// PathPrefix is a URL path prefix under which the node server is
+	// mounted, such as when it is served behind a reverse proxy. It is
+	// removed from each request's path before the request is recognized.
+	PathPrefix string
+
+	// Logger receives all log output from the server other than that of
+	// the underlying HTTP server. If nil, warnings and errors are written
+	// to ErrorLog or to the standard logger, and debug output is discarded.
+	Logger Logger
+
+	// Metrics, if set, is notified of requests handled and reports sent.
+	Metrics Metrics
+
+	// Reporter, if set, receives all reports to the ISY instead of them
+	// being sent over HTTP. This is intended for testing, using a
+	// RecordingClient.
+	Reporter Reporter
+
+	// Retry controls whether and how reports to the ISY are retried after
+	// transient failures. By default they are not retried.
+	Retry RetryPolicy
+
+	// Handler, if set, receives requests instead of the Requests channel.
+	Handler Handler
+
+	// Responder, if set, is called for each recognized request to allow
+	// a custom response to be sent to the ISY in place of the usual
+	// 204 No Content, such as an XML acknowledgement of an install
+	// request. It should write the response to the given ResponseWriter
+	// and return true, or return false to send the usual response.
+	//
+	// Responder is called just before the request is passed to Handler,
+	// or just after it is queued in Requests, and must not block.
+	Responder func(req Request, w http.ResponseWriter) bool
+
+	// DedupWindow, if set, enables detection of requests that the ISY
+	// delivers more than once, such as when it didn't see our response
+	// in time. A request whose requestId matches one that is still being
+	// handled, or that was completed within this window, is acknowledged
+	// without being delivered again. If the earlier request was completed
+	// then its result is reported to the ISY again.
+	DedupWindow time.Duration
+
+	// CompleteTimeout, if set, limits how long a request with a requestId
+	// may remain uncompleted. If a request is not completed within this
+	// time then the server logs a warning and reports failure to the ISY,
+	// so that the ISY is not left waiting indefinitely. Any later attempt
+	// to complete the request is ignored.
+	CompleteTimeout time.Duration
+
+	// ShortPoll and LongPoll, if set, are the initial intervals at which
+	// the server produces PollRequests. See SetPollIntervals.
+	ShortPoll time.Duration
+	LongPoll  time.Duration
+
+	// OnUnrecognized, if set, is called for each request from the ISY that
+	// the server cannot interpret, such as a request for an endpoint this
+	// package doesn't yet support. Such requests are also logged, and the
+	// ISY receives a 404 response.
+	OnUnrecognized func(UnrecognizedRequest)
+
+	// RequestBufferSize is the number of requests that can be queued in
+	// the Requests channel before the server waits for them to be read.
+	// The default of zero means that each request is handed over directly.
+	RequestBufferSize int
+
+	// AdminListenAddr, if set, is the address of a second listener that
+	// serves only diagnostics, without requiring the ISY's credentials.
+	// Use ListenAndServeAdmin to start it. See AdminHandler for what it
+	// serves.
+	AdminListenAddr string
+
+	// AdminHandler, if set, is served by the admin listener for all paths
+	// other than the built-in ones, such as to expose a metrics endpoint
+	// for scraping.
+	AdminHandler http.Handler
+
 	// Credentials used for the ISY to authenticate to the node server
 	Username string
 	Password string
+
+	// DigestAuth enables HTTP Digest authentication, as used by some ISY
+	// firmware versions, in addition to Basic authentication.
+	DigestAuth bool
+
+	// ClientCAs, if set, requires the ISY to present a TLS client
+	// certificate issued by one of the given authorities, in addition to
+	// its username and password. This takes effect only when serving TLS.
+	ClientCAs *x509.CertPool
+
+	// ClientCertOnly, if set along with ClientCAs, accepts a verified
+	// client certificate in place of a username and password.
+	ClientCertOnly bool
 }
 
+// NewServer creates a new node server for the given profile number.
+//
+// isyConfig describes how the node server reaches the ISY to report
+// status and results. If isyConfig.HTTPClient is set then it is used for
+// those requests, which allows setting a custom timeout or TLS settings.
 func NewServer(config *Config, profileNum int, isyConfig *isy.ClientConfig) (*Server, error) {
-	relPath := path.Join("rest", "ns", strconv.Itoa(profileNum)) + "/"
-	relURL, err := url.Parse(relPath)
-	if err != nil {
-		// should never happen
-		panic("failed to parse self-generated service relative path")
+	if profileNum < minProfileNum || profileNum > maxProfileNum {
+		return nil, fmt.Errorf("invalid profile number %d: must be between %d and %d", profileNum, minProfileNum, maxProfileNum)
 	}
 
 	baseURL, err := url.Parse(isyConfig.BaseURL)
@@ -90,28 +290,108 @@ func NewServer(config *Config, profileNum int, isyConfig *isy.ClientConfig) (*Se
 		TLSConfig: config.TLSConfig,
 		ErrorLog:  config.ErrorLog,
 	}
+	if config.ClientCAs != nil {
+		if hs.TLSConfig == nil {
+			hs.TLSConfig = &tls.Config{}
+		} else {
+			hs.TLSConfig = hs.TLSConfig.Clone()
+		}
+		hs.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		hs.TLSConfig.ClientCAs = config.ClientCAs
+	}
 
 	s := &Server{}
-	s.rawReqs = make(chan Request)
+	s.rawReqs = make(chan Request, config.RequestBufferSize)
+	s.abandon = make(chan struct{})
+	s.rejecting = make(chan struct{})
+	s.pending = make(map[string]time.Time)
+	s.dedupWindow = config.DedupWindow
+	s.completed = make(map[string]completedRequest)
+	s.completeTimeout = config.CompleteTimeout
+	s.watchdogs = make(map[string]*watchdog)
+	s.timedOut = make(map[string]time.Time)
+	s.timedOutRetention = timedOutRetention
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	s.now = time.Now
 	s.Requests = s.rawReqs // read-only version for public consumption
 	s.httpServer = hs
-	s.username = config.Username
+	s.router = newRouter()
+	s.routeTemplates = routeTemplates(s.router)
+	usernameSHA256 := sha256.Sum256([]byte(config.Username))
+	s.usernameSHA256 = usernameSHA256[:]
 	passwordSHA256 := sha256.Sum256([]byte(config.Password))
 	s.passwordSHA256 = passwordSHA256[:]
-	s.addrPrefix = fmt.Sprintf("n%03d_", profileNum)
+	if config.DigestAuth {
+		s.digestAuth = true
+		s.digestHA1 = md5Hex(config.Username + ":" + digestRealm + ":" + config.Password)
+		s.nonceKey = make([]byte, 32)
+		_, err := rand.Read(s.nonceKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate digest nonce key: %s", err)
+		}
+	}
+	s.clientCerts = config.ClientCAs != nil
+	s.clientCertOnly = s.clientCerts && config.ClientCertOnly
+	s.reqHandler = config.Handler
+	s.onUnrecognized = config.OnUnrecognized
+	s.responder = config.Responder
+	s.logger = config.Logger
+	if s.logger == nil {
+		s.logger = stdLogger{config.ErrorLog}
+	}
+	s.reporter = config.Reporter
+	s.retry = config.Retry
+	s.metrics = config.Metrics
+	if s.metrics == nil {
+		s.metrics = nopMetrics{}
+	}
 
-	hs.Handler = http.HandlerFunc(s.handler)
+	var handler http.Handler = http.HandlerFunc(s.serveHTTP)
+	if prefix := strings.TrimSuffix(config.PathPrefix, "/"); prefix != "" {
+		handler = http.StripPrefix(prefix, handler)
+	}
+	hs.Handler = handler
 
-	s.client = nsClient{
-		BaseURL:    baseURL.ResolveReference(relURL),
-		AddrPrefix: s.addrPrefix,
-		Username:   isyConfig.Username,
-		Password:   isyConfig.Password,
+	s.isyBaseURL = baseURL
+	s.isyConfig = *isyConfig
+	if s.isyConfig.HTTPClient == nil {
+		s.isyConfig.HTTPClient = &http.Client{
+			Timeout: defaultISYTimeout,
+		}
+	}
+	s.isyClient, err = isy.NewClient(&s.isyConfig)
+	if err != nil {
+		return nil, err
+	}
+	s.adminHandler = s.newAdminHandler(config.AdminHandler)
+	if config.AdminListenAddr != "" {
+		s.adminServer = &http.Server{
+			Addr:     config.AdminListenAddr,
+			Handler:  s.adminHandler,
+			ErrorLog: config.ErrorLog,
+		}
+	}
+
+	s.ProfileClient = s.newProfileClient(profileNum)
+	s.profiles = map[int]*ProfileClient{
+		profileNum: s.ProfileClient,
+	}
+	s.profileServers = make(map[int]*http.Server)
+	if config.ShortPoll > 0 || config.LongPoll > 0 {
+		s.SetPollIntervals(config.ShortPoll, config.LongPoll)
 	}
 
 	return s, nil
 }
 
+// ServeHTTP handles a single request from the ISY, allowing the server to be
+// used as an http.Handler, such as when combining it with other handlers in
+// an existing HTTP server. The request path must include the configured
+// PathPrefix, if any.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.httpServer.Handler.ServeHTTP(w, r)
+}
+
 func (s *Server) Serve(l net.Listener) error {
 	return s.httpServer.Serve(l)
 }
@@ -120,144 +400,804 @@ func (s *Server) ListenAndServe() error {
 	return s.httpServer.ListenAndServe()
 }
 
+// ListenAndServeUnix listens on a Unix domain socket at the given path and
+// then serves requests on it. A stale socket left behind by a previous
+// process is removed first, and the socket is removed again once serving
+// ends.
+func (s *Server) ListenAndServeUnix(path string) error {
+	err := removeStaleSocket(path)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	err = os.Chmod(path, unixSocketMode)
+	if err != nil {
+		l.Close()
+		return err
+	}
+
+	return s.Serve(l)
+}
+
 func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
 	return s.httpServer.ListenAndServeTLS(certFile, keyFile)
 }
 
-func (s *Server) AddNode(addr, defId, primaryAddr, name string) error {
-	return s.client.AddNode(addr, defId, primaryAddr, name)
+// ListenAndServeAdmin listens on Config.AdminListenAddr and serves the
+// handler returned by AdminHandler. It returns an error immediately if no
+// admin address was configured. Shutdown also shuts down the admin
+// listener.
+func (s *Server) ListenAndServeAdmin() error {
+	if s.adminServer == nil {
+		return errors.New("no admin listen address is configured")
+	}
+	return s.adminServer.ListenAndServe()
 }
 
-func (s *Server) ReportNodeStatus(addr, field, value string, uom isy.UOM) error {
-	return s.client.ReportNodeStatus(addr, field, value, uom)
+// AdminHandler returns the handler served by the admin listener, which can
+// also be mounted on another server. It serves /healthz, which responds
+// with 200 OK while the server is accepting requests and 503 Service
+// Unavailable otherwise, such as when it has been marked as not ready with
+// SetReady. All other paths are passed to Config.AdminHandler, if set.
+//
+// The admin handler does not require any authentication.
+func (s *Server) AdminHandler() http.Handler {
+	return s.adminHandler
 }
 
-func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
-	username, password, authed := r.BasicAuth()
-	if !authed {
-		http.Error(w, "Unauthorized", 401)
-		return
+func (s *Server) newAdminHandler(extra http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.serveHealthz)
+	if extra != nil {
+		mux.Handle("/", extra)
 	}
-	if username != s.username {
-		http.Error(w, "Unauthorized", 401)
+	return mux
+}
+
+func (s *Server) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ready := !s.shuttingDown && !s.notReady && !s.isRejecting()
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "not ready\n")
 		return
 	}
-	passwordSHA256 := sha256.Sum256([]byte(password))
-	if subtle.ConstantTimeCompare(passwordSHA256[:], s.passwordSHA256) != 1 {
+	io.WriteString(w, "ok\n")
+}
+
+// Shutdown gracefully shuts down the server, first stopping the underlying
+// HTTP servers, including those of additional profiles, and then waiting for any requests not yet read from Requests
+// to be consumed. Once all pending requests are delivered, the Requests
+// channel is closed.
+//
+// If the given context expires before shutdown is complete then any pending
+// requests are abandoned, Requests is closed regardless, and the context's
+// error is returned. A clean shutdown returns nil. Calls to Config.Handler
+// that are still running at that point are not waited for.
+//
+// In either case, the contexts of all requests are cancelled before
+// Shutdown returns.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		return errors.New("server is already shutting down")
+	}
+	s.shuttingDown = true
+	s.mu.Unlock()
+
+	err := s.httpServer.Shutdown(ctx)
+	s.profilesMu.RLock()
+	for _, hs := range s.profileServers {
+		if perr := hs.Shutdown(ctx); err == nil {
+			err = perr
+		}
+	}
+	s.profilesMu.RUnlock()
+	if err == nil {
+		drained := make(chan struct{})
+		go func() {
+			s.inFlight.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	// If we timed out then there may still be handlers blocked trying to
+	// deliver requests, so we must release them before closing the channel.
+	// Those are bounded by abandon, unlike calls to reqHandler, which we
+	// leave running.
+	s.cancelBase()
+	close(s.abandon)
+	s.senders.Wait()
+	close(s.rawReqs)
+
+	// The admin listener stays up until now so that health checks can see
+	// that the server is shutting down. It serves only diagnostics, so
+	// there is nothing to drain.
+	if s.adminServer != nil {
+		s.adminServer.Close()
+	}
+
+	return err
+}
+
+// StopAccepting puts the server into a mode where it responds to all
+// further requests from the ISY with 503 Service Unavailable, including any
+// that are currently blocked waiting to be read from Requests.
+//
+// A program should call this if it stops reading from Requests for any
+// reason other than a call to Shutdown, since otherwise requests will block
+// indefinitely. The HTTP server continues running until Shutdown is called.
+func (s *Server) StopAccepting() {
+	s.stopAccepting.Do(func() {
+		close(s.rejecting)
+	})
+}
+
+// SetReady controls whether the server accepts requests that need the
+// devices behind the node server, such as commands and queries. While it is
+// not ready the server responds to those with 503 Service Unavailable, so
+// that the ISY will retry them later, but still accepts requests that only
+// manage nodes, such as installing or adding nodes.
+//
+// A server is ready when created. A program might mark it as not ready while
+// its connection to the devices is being re-established.
+func (s *Server) SetReady(ready bool) {
+	s.mu.Lock()
+	s.notReady = !ready
+	s.mu.Unlock()
+}
+
+// AddProfile adds an additional profile number to be served by the server,
+// for node servers that occupy more than one profile slot on the ISY.
+//
+// Requests for nodes belonging to the new profile are delivered in the same
+// way as for the server's primary profile, and can be distinguished using
+// Request.ProfileNum.
+//
+// Some requests, such as to add all nodes or to update custom parameters,
+// do not name a node and so do not otherwise identify their profile. The
+// ISY sends the requests for each profile to the host and port configured
+// for that profile's slot, so each additional profile should be given its
+// own listener using ServeProfile or ListenAndServeProfile. Requests that
+// arrive on the primary listener belong to the primary profile unless they
+// name a node of another profile.
+func (s *Server) AddProfile(profileNum int) error {
+	if profileNum < minProfileNum || profileNum > maxProfileNum {
+		return fmt.Errorf("invalid profile number %d: must be between %d and %d", profileNum, minProfileNum, maxProfileNum)
+	}
+
+	s.profilesMu.Lock()
+	defer s.profilesMu.Unlock()
+	if _, exists := s.profiles[profileNum]; exists {
+		return fmt.Errorf("profile number %d is already being served", profileNum)
+	}
+	s.profiles[profileNum] = s.newProfileClient(profileNum)
+	s.profileServers[profileNum] = &http.Server{
+		TLSConfig: s.httpServer.TLSConfig,
+		ErrorLog:  s.httpServer.ErrorLog,
+		Handler:   s.ProfileHandler(profileNum),
+	}
+	return nil
+}
+
+// ServeProfile serves requests for the given additional profile on the
+// given listener. All requests received on it belong to that profile,
+// including those that do not name a node. Shutdown also shuts down the
+// listener.
+func (s *Server) ServeProfile(profileNum int, l net.Listener) error {
+	hs, err := s.profileServer(profileNum)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	return hs.Serve(l)
+}
+
+// ListenAndServeProfile is like ServeProfile but listens on the given TCP
+// address.
+func (s *Server) ListenAndServeProfile(profileNum int, addr string) error {
+	hs, err := s.profileServer(profileNum)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return hs.Serve(l)
+}
+
+// ProfileHandler returns a handler for the requests of the given profile,
+// for use when combining the server with other handlers in an existing HTTP
+// server. Like ServeHTTP, the request path must include the configured
+// PathPrefix, if any.
+func (s *Server) ProfileHandler(profileNum int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), profileNumKey{}, profileNum)
+		s.httpServer.Handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// profileNumKey is the context key under which ProfileHandler records the
+// profile a request was received for.
+type profileNumKey struct{}
+
+func (s *Server) profileServer(profileNum int) (*http.Server, error) {
+	s.profilesMu.RLock()
+	defer s.profilesMu.RUnlock()
+	hs, ok := s.profileServers[profileNum]
+	if !ok {
+		return nil, fmt.Errorf("profile %d is not an additional profile of this server", profileNum)
+	}
+	return hs, nil
+}
+
+// Profile returns the ProfileClient for the given profile number, or nil
+// if the server is not serving that profile.
+func (s *Server) Profile(profileNum int) *ProfileClient {
+	s.profilesMu.RLock()
+	defer s.profilesMu.RUnlock()
+	return s.profiles[profileNum]
+}
+
+func (s *Server) newProfileClient(profileNum int) *ProfileClient {
+	relPath := path.Join("rest", "ns", strconv.Itoa(profileNum)) + "/"
+	relURL, err := url.Parse(relPath)
+	if err != nil {
+		// should never happen
+		panic("failed to parse self-generated service relative path")
+	}
+
+	return &ProfileClient{
+		num:       profileNum,
+		server:    s,
+		isyClient: s.isyClient,
+		client: &nsClient{
+			BaseURL:     s.isyBaseURL.ResolveReference(relURL),
+			AddrPrefix:  fmt.Sprintf("n%03d_", profileNum),
+			Username:    s.isyConfig.Username,
+			Password:    s.isyConfig.Password,
+			Credentials: s.isyConfig.Credentials,
+			HTTPClient:  s.isyConfig.HTTPClient,
+			Logger:      s.logger,
+			Metrics:     s.metrics,
+			Reporter:    s.reporter,
+			Retry:       s.retry,
+			ctx:         s.baseCtx,
+		},
+	}
+}
+
+// profileForAddr returns the profile that the given absolute node address
+// belongs to, based on its prefix. If the address doesn't belong to any
+// profile being served then the primary profile is returned.
+func (s *Server) profileForAddr(addr string) *ProfileClient {
+	if len(addr) > 5 && addr[0] == 'n' && addr[4] == '_' {
+		if num, err := strconv.Atoi(addr[1:4]); err == nil {
+			if p := s.Profile(num); p != nil {
+				return p
+			}
+		}
+	}
+	return s.ProfileClient
+}
+
+// serveHTTP wraps handler to recover from any panic while handling a
+// request, so that a single bad request can't take down the server.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	rw := &recordingResponseWriter{ResponseWriter: w}
+	defer func() {
+		if v := recover(); v != nil {
+			s.logger.Printf("panic while handling %s %s: %v\n%s", r.Method, r.URL.Path, v, debug.Stack())
+			if !rw.wroteHeader {
+				http.Error(rw, "Internal Server Error", 500)
+			}
+		}
+	}()
+
+	s.handler(rw, r)
+}
+
+// recordingResponseWriter is an http.ResponseWriter that records whether
+// a response header has been written.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recordingResponseWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingResponseWriter) Write(buf []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(buf)
+}
+
+func (w *recordingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	if !s.authenticate(r) {
+		if s.digestAuth {
+			w.Header().Set("WWW-Authenticate", s.digestChallenge())
+		}
 		http.Error(w, "Unauthorized", 401)
 		return
 	}
 
+	// A request received on the listener of an additional profile belongs
+	// to that profile regardless of its content.
+	var listened *ProfileClient
+	if num, ok := r.Context().Value(profileNumKey{}).(int); ok {
+		listened = s.Profile(num)
+		if listened == nil {
+			s.unrecognized(w, r, fmt.Sprintf("profile %d is not served by this server", num))
+			return
+		}
+	}
+
+	// The ISY is inconsistent about trailing slashes and about the case of
+	// the fixed parts of the path, so we normalize those before matching.
+	if normalized := normalizeRoutePath(s.routeTemplates, r.URL.Path); normalized != r.URL.Path {
+		r.URL.Path = normalized
+		r.URL.RawPath = ""
+	}
+
 	match := mux.RouteMatch{}
-	matched := router.Match(r, &match)
+	matched := s.router.Match(r, &match)
 	if !matched {
-		http.Error(w, "Not Found", 404)
+		s.unrecognized(w, r, "no matching route")
 		return
 	}
 
+	kind := match.Route.GetName()
+	defer func() {
+		s.metrics.ObserveRequest(kind, time.Since(start))
+	}()
+
+	p := s.ProfileClient
+	if listened != nil {
+		p = listened
+	}
+	var nodeAddr string
+	if given, ok := match.Vars["nodeAddr"]; ok {
+		if listened == nil {
+			p = s.profileForAddr(given)
+		}
+		nodeAddr, ok = p.client.ParseAddr(given)
+		if !ok {
+			s.unrecognized(w, r, fmt.Sprintf("node address %q does not belong to a profile served by this server", given))
+			return
+		}
+	}
+
 	var req Request
-	switch match.Route.GetName() {
+	var reason string
+	switch kind {
 	case "install":
+		num, err := strconv.Atoi(match.Vars["profileNum"])
+		if err != nil {
+			reason = fmt.Sprintf("invalid profile number %q", match.Vars["profileNum"])
+			break
+		}
+		p = s.Profile(num)
+		if p == nil {
+			reason = fmt.Sprintf("profile %d is not served by this server", num)
+			break
+		}
 		req = &InstallRequest{
-			request: s.makeCommonReq(r),
+			request: s.makeCommonReq(r, p),
 		}
 	case "nodeQuery":
 		req = &NodeQueryRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 		}
 	case "nodeStatus":
 		req = &NodeStatusValuesRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 		}
-	case "addAllNodes":
+	case "addAllNodes", "discover":
 		req = &AddAllNodesRequest{
-			request: s.makeCommonReq(r),
+			request:  s.makeCommonReq(r, p),
+			Discover: kind == "discover",
 		}
 	case "addNode":
+		var primaryAddr string
+		if given := r.URL.Query().Get("primary"); given != "" {
+			var ok bool
+			primaryAddr, ok = p.client.ParseAddr(given)
+			if !ok {
+				reason = fmt.Sprintf("primary node address %q does not belong to profile %d", given, p.num)
+				break
+			}
+		}
 		req = &AddNodeRequest{
-			request:     s.makeCommonReq(r),
-			NodeAddr:    s.parseAddr(match.Vars["nodeAddr"]),
+			request:     s.makeCommonReq(r, p),
+			NodeAddr:    nodeAddr,
 			NodeDefID:   match.Vars["nodeDefId"],
-			PrimaryAddr: s.parseAddr(r.URL.Query().Get("primary")),
+			PrimaryAddr: primaryAddr,
 			Name:        r.URL.Query().Get("name"),
 		}
 	case "removeNode":
 		req = &RemoveNodeRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 		}
 	case "renameNode":
 		req = &RenameNodeRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 			Name:     r.URL.Query().Get("name"),
 		}
 	case "enableNode":
 		req = &EnableNodeRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 			Enabled:  true,
 		}
 	case "disableNode":
 		req = &EnableNodeRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 			Enabled:  false,
 		}
+	case "customParams":
+		params, err := s.makeCustomParams(r)
+		if err != nil {
+			reason = fmt.Sprintf("invalid custom parameters: %s", err)
+			break
+		}
+		req = &CustomParamsRequest{
+			request: s.makeCommonReq(r, p),
+			Params:  params,
+		}
 	case "nodeCommand":
 		req = &CommandRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 			Command:  match.Vars["command"],
 			Params:   s.makeCommandParams(r),
 		}
 	case "nodeCommandValue":
 		req = &CommandRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 			Command:  match.Vars["command"],
 			Param: &CommandParam{
-				Value: match.Vars["value"],
+				Value:  match.Vars["value"],
+				Values: []string{match.Vars["value"]},
 			},
 			Params: s.makeCommandParams(r),
 		}
 	case "nodeCommandValueUnit":
 		unit, err := strconv.Atoi(match.Vars["unit"])
 		if err != nil {
-			// ignore invalid request
+			reason = fmt.Sprintf("invalid unit of measure %q", match.Vars["unit"])
 			break
 		}
 		req = &CommandRequest{
-			request:  s.makeCommonReq(r),
-			NodeAddr: s.parseAddr(match.Vars["nodeAddr"]),
+			request:  s.makeCommonReq(r, p),
+			NodeAddr: nodeAddr,
 			Command:  match.Vars["command"],
 			Param: &CommandParam{
-				Value: match.Vars["value"],
-				UOM:   isy.UOM(unit),
+				Value:  match.Vars["value"],
+				UOM:    isy.UOM(unit),
+				Values: []string{match.Vars["value"]},
 			},
 			Params: s.makeCommandParams(r),
 		}
 	}
 
 	if req == nil {
-		http.Error(w, "Not Found", 404)
+		s.unrecognized(w, r, reason)
+		return
+	}
+
+	if req.ID() == "" && isMutatingRequest(req) {
+		// The ISY is supposed to include a requestId with any request
+		// that changes something, so that we can report the outcome.
+		// Its absence usually indicates a firmware bug.
+		s.logger.Printf("warning: %s %s has no requestId, so its outcome cannot be reported", r.Method, r.URL.Path)
+	}
+
+	s.mu.Lock()
+	if s.shuttingDown || s.isRejecting() || (s.notReady && isDeviceRequest(req)) {
+		s.mu.Unlock()
+		http.Error(w, "Service Unavailable", 503)
+		return
+	}
+	s.inFlight.Add(1)
+	if s.reqHandler == nil {
+		s.senders.Add(1)
+		defer s.senders.Done()
+	}
+	s.mu.Unlock()
+	defer s.inFlight.Done()
+
+	// We start tracking the request before delivering it, since it might
+	// be completed before delivery returns.
+	if prior, dup := s.track(req); dup {
+		s.logger.Debugf("ignoring repeated delivery of request %s", req.ID())
+		s.acknowledge(w, req)
+		if prior.done {
+			err := req.Profile().client.ReportRequestStatus(req.ID(), prior.success)
+			if err != nil {
+				s.logger.Printf("failed to repeat result of request %s: %s", req.ID(), err)
+			}
+		}
 		return
 	}
 
 	// The ISY protocol calls for us to return immediately if we recognize
 	// the request, and then deal with the request contents asynchronously.
+	if s.reqHandler != nil {
+		s.acknowledge(w, req)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		dispatch(s.reqHandler, req)
+		return
+	}
+
+	// When using the Requests channel we only acknowledge the request once
+	// it has been queued, so that a request abandoned during shutdown is
+	// reported to the ISY as not accepted.
+	select {
+	case s.rawReqs <- req:
+		s.acknowledge(w, req)
+	case <-s.abandon:
+		s.untrack(req.ID())
+		http.Error(w, "Service Unavailable", 503)
+	case <-s.rejecting:
+		s.untrack(req.ID())
+		http.Error(w, "Service Unavailable", 503)
+	case <-r.Context().Done():
+		// The ISY gave up waiting, so there's nobody to respond to.
+		s.untrack(req.ID())
+	}
+}
+
+// InFlight returns the IDs of the requests that have been delivered, or are
+// being delivered, but have not yet been completed, in the order they were
+// received. Requests without an ID are not included.
+func (s *Server) InFlight() []string {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	ret := make([]string, 0, len(s.pending))
+	for id := range s.pending {
+		ret = append(ret, id)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		ti, tj := s.pending[ret[i]], s.pending[ret[j]]
+		if ti.Equal(tj) {
+			return ret[i] < ret[j]
+		}
+		return ti.Before(tj)
+	})
+	return ret
+}
+
+// track records that the request with the given ID is in flight. If
+// deduplication is enabled and a request with the same ID is already in
+// flight or was completed within the dedup window then the result is true,
+// along with the outcome of the earlier request if known, and the request
+// is not tracked.
+func (s *Server) track(req Request) (completedRequest, bool) {
+	id := req.ID()
+	if id == "" {
+		return completedRequest{}, false
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if s.dedupWindow > 0 {
+		if at, ok := s.pending[id]; ok {
+			return completedRequest{at: at}, true
+		}
+		if prior, ok := s.completed[id]; ok {
+			if time.Since(prior.at) <= s.dedupWindow {
+				return prior, true
+			}
+			delete(s.completed, id)
+		}
+	}
+	s.pending[id] = time.Now()
+	if s.completeTimeout > 0 {
+		s.stopWatchdog(id)
+		w := &watchdog{}
+		w.timer = time.AfterFunc(s.completeTimeout, func() {
+			s.expire(req, w)
+		})
+		s.watchdogs[id] = w
+		delete(s.timedOut, id)
+	}
+	return completedRequest{}, false
+}
+
+// untrack records that the request with the given ID is no longer in
+// flight.
+func (s *Server) untrack(id string) {
+	s.pendingMu.Lock()
+	delete(s.pending, id)
+	s.stopWatchdog(id)
+	s.pendingMu.Unlock()
+}
+
+// stopWatchdog stops the completion timer for the request with the given
+// ID, if any. The caller must hold pendingMu.
+func (s *Server) stopWatchdog(id string) {
+	if w := s.watchdogs[id]; w != nil {
+		w.timer.Stop()
+		delete(s.watchdogs, id)
+	}
+}
+
+// watchdog is the completion timer for a single request.
+type watchdog struct {
+	timer *time.Timer
+}
+
+// expire reports failure for a request that was not completed within
+// completeTimeout, unless it has been completed in the meantime.
+func (s *Server) expire(req Request, w *watchdog) {
+	id := req.ID()
+	s.pendingMu.Lock()
+	if s.watchdogs[id] != w {
+		s.pendingMu.Unlock()
+		return
+	}
+	delete(s.watchdogs, id)
+	delete(s.pending, id)
+	now := time.Now()
+	for prevID, at := range s.timedOut {
+		if now.Sub(at) > s.timedOutRetention {
+			delete(s.timedOut, prevID)
+		}
+	}
+	s.timedOut[id] = now
+	s.remember(id, false)
+	s.pendingMu.Unlock()
+
+	s.logger.Printf("warning: request %s was not completed within %s, so reporting failure", id, s.completeTimeout)
+	err := req.Profile().client.ReportRequestStatus(id, false)
+	if err != nil {
+		s.logger.Printf("failed to report failure of request %s: %s", id, err)
+	}
+}
+
+// completedRequest is the outcome of a request, retained to deal with
+// repeated deliveries of the same request.
+type completedRequest struct {
+	at      time.Time
+	done    bool
+	success bool
+}
+
+// finish records that the request with the given ID has been completed
+// with the given outcome, so that it is no longer in flight.
+//
+// The outcome is retained before it is reported, so that a repeated
+// delivery that arrives while the report is being sent, or after it
+// failed, causes the outcome to be reported again rather than the request
+// being handled again.
+//
+// The result is false if the request's failure was already reported
+// because it was not completed in time, in which case the outcome should
+// not be reported.
+func (s *Server) finish(id string, success bool) bool {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if _, ok := s.timedOut[id]; ok {
+		delete(s.timedOut, id)
+		return false
+	}
+	delete(s.pending, id)
+	s.stopWatchdog(id)
+	s.remember(id, success)
+	return true
+}
+
+// remember retains the outcome of the request with the given ID, if
+// deduplication is enabled, and forgets any outcomes that have aged out of
+// the dedup window. The caller must hold pendingMu.
+func (s *Server) remember(id string, success bool) {
+	if s.dedupWindow <= 0 {
+		return
+	}
+	now := time.Now()
+	for prevID, prior := range s.completed {
+		if now.Sub(prior.at) > s.dedupWindow {
+			delete(s.completed, prevID)
+		}
+	}
+	s.completed[id] = completedRequest{at: now, done: true, success: success}
+}
+
+// isRejecting returns true if StopAccepting has been called.
+func (s *Server) isRejecting() bool {
+	select {
+	case <-s.rejecting:
+		return true
+	default:
+		return false
+	}
+}
+
+// acknowledge writes the immediate response to a recognized request, which
+// is 204 No Content unless the configured Responder writes another.
+func (s *Server) acknowledge(w http.ResponseWriter, req Request) {
+	if s.responder != nil && s.responder(req, w) {
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnrecognizedRequest describes a request from the ISY that the server was
+// unable to interpret.
+type UnrecognizedRequest struct {
+	Method   string
+	Path     string
+	RawQuery string
 
-	s.rawReqs <- req
+	// Reason is a short description of why the request was not recognized.
+	Reason string
 }
 
-func (s *Server) makeCommonReq(r *http.Request) request {
-	rid := r.URL.Query().Get("requestId")
+// unrecognized reports that the given request could not be interpreted,
+// both to the log and to the configured callback, if any, and then
+// responds with 404 Not Found.
+func (s *Server) unrecognized(w http.ResponseWriter, r *http.Request, reason string) {
+	s.logger.Printf("warning: unrecognized request %s %s: %s", r.Method, r.URL.Path, reason)
+	if s.onUnrecognized != nil {
+		s.onUnrecognized(UnrecognizedRequest{
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+			Reason:   reason,
+		})
+	}
+	http.Error(w, "Not Found", 404)
+}
+
+func (s *Server) makeCommonReq(r *http.Request, p *ProfileClient) request {
+	query := r.URL.Query()
+	rid := query.Get("requestId")
 	return request{
-		id:     rid,
-		server: s,
+		id:      rid,
+		server:  s,
+		profile: p,
+		ctx:     s.baseCtx,
+		query:   query,
+		header:  r.Header.Clone(),
+		cert:    verifiedClientCert(r),
+		at:      s.now(),
 	}
 }
 
@@ -271,69 +1211,206 @@ func (s *Server) makeCommandParams(r *http.Request) map[string]CommandParam {
 			continue
 		}
 
-		var name string
-		var uom isy.UOM
-		if splitPos := strings.Index(k, ".uom"); splitPos != -1 {
-			namePrefix := k[0:splitPos]
-			uomStr := k[splitPos+4:]
-			unit, err := strconv.Atoi(uomStr)
-			if err != nil {
-				uom = isy.UOMUnknown
-				name = k
-			} else {
-				uom = isy.UOM(unit)
-				name = namePrefix
-			}
-		} else {
-			uom = isy.UOMUnknown
-			name = k
-		}
+		name, uom := splitUOMSuffix(k)
 
 		if ret == nil {
 			ret = make(map[string]CommandParam)
 		}
 		ret[name] = CommandParam{
-			Value: vs[0],
-			UOM:   uom,
+			Value:  vs[0],
+			UOM:    uom,
+			Values: vs,
 		}
 	}
 	return ret
 }
 
-func (s *Server) formatAddr(base string) string {
-	return s.addrPrefix + base
+// splitUOMSuffix splits a command parameter key like "level.uom51" into its
+// name and unit of measure. If the key doesn't end with ".uom" followed by
+// one or more digits then it is returned verbatim with UOMUnknown.
+func splitUOMSuffix(k string) (string, isy.UOM) {
+	splitPos := strings.LastIndex(k, ".uom")
+	if splitPos == -1 {
+		return k, isy.UOMUnknown
+	}
+
+	digits := k[splitPos+len(".uom"):]
+	if digits == "" {
+		return k, isy.UOMUnknown
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return k, isy.UOMUnknown
+		}
+	}
+
+	unit, err := strconv.Atoi(digits)
+	if err != nil {
+		// Only possible if the number is too large to represent
+		return k, isy.UOMUnknown
+	}
+	return k[:splitPos], isy.UOM(unit)
+}
+
+// maxCustomParamsLen is the largest custom parameters body the server will
+// accept from the ISY.
+const maxCustomParamsLen = 1 << 20
+
+// makeCustomParams collects the custom parameters from the query string and
+// from the request body, which the ISY sends as a JSON object of strings.
+// Parameters in the body take precedence.
+func (s *Server) makeCustomParams(r *http.Request) (map[string]string, error) {
+	ret := make(map[string]string)
+	for k, vs := range r.URL.Query() {
+		if k == "requestId" {
+			continue
+		}
+		if len(vs) == 0 {
+			continue
+		}
+		ret[k] = vs[0]
+	}
+
+	if r.Body == nil {
+		return ret, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCustomParamsLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxCustomParamsLen {
+		return nil, fmt.Errorf("body is larger than %d bytes", maxCustomParamsLen)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ret, nil
+	}
+	var fromBody map[string]string
+	err = json.Unmarshal(body, &fromBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fromBody {
+		ret[k] = v
+	}
+	return ret, nil
 }
 
-func (s *Server) parseAddr(given string) string {
-	if !strings.HasPrefix(given, s.addrPrefix) {
-		// Should never happen if the server is behaving
-		return given
+// removeStaleSocket removes a socket file at the given path if nothing is
+// listening on it. It returns an error if the path exists but is not a
+// socket, or if another process is still listening.
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is already in use", path)
 	}
 
-	return given[len(s.addrPrefix):]
+	return os.Remove(path)
 }
 
 type nsClient struct {
-	BaseURL    *url.URL
-	AddrPrefix string
-	Username   string
-	Password   string
+	BaseURL     *url.URL
+	AddrPrefix  string
+	Username    string
+	Password    string
+	Credentials isy.CredentialsFunc
+	HTTPClient  *http.Client
+	Logger      Logger
+	Metrics     Metrics
+	Reporter    Reporter
+	Retry       RetryPolicy
+
+	// ctx aborts any wait between retries when cancelled.
+	ctx context.Context
 }
 
 func (c *nsClient) Request(url *url.URL) error {
+	return c.RequestContext(context.Background(), url, "")
+}
+
+// RequestFor is like Request but includes the given label in log messages,
+// to correlate the report with the node or request it relates to.
+func (c *nsClient) RequestFor(url *url.URL, label string) error {
+	return c.RequestContext(context.Background(), url, label)
+}
+
+// RequestContext is like RequestFor but abandons the request, including any
+// retries, when the given context is cancelled.
+func (c *nsClient) RequestContext(ctx context.Context, url *url.URL, label string) error {
+	var err error
+	if c.Reporter != nil {
+		err = c.Reporter.Report(c.BaseURL.ResolveReference(url))
+	} else {
+		err = c.requestWithRetry(ctx, url, label)
+	}
+	c.Metrics.ObserveReport(err == nil)
+	return err
+}
+
+func (c *nsClient) requestWithRetry(ctx context.Context, url *url.URL, label string) error {
+	err := c.request(ctx, url, label)
+	for retry := 1; retry < c.Retry.MaxAttempts && isRetryable(err); retry++ {
+		delay := c.Retry.delay(retry)
+		c.Logger.Debugf("retrying %s%s in %s after error: %s", url, logLabel(label), delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-c.ctx.Done():
+			timer.Stop()
+			return err
+		}
+		err = c.request(ctx, url, label)
+	}
+	return err
+}
+
+// logLabel formats a label given to RequestFor for inclusion in a log
+// message.
+func logLabel(label string) string {
+	if label == "" {
+		return ""
+	}
+	return " [" + label + "]"
+}
+
+func (c *nsClient) request(ctx context.Context, url *url.URL, label string) error {
 	url = c.BaseURL.ResolveReference(url)
-	req, err := http.NewRequest("GET", url.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
 	if err != nil {
 		return err
 	}
-	req.SetBasicAuth(c.Username, c.Password)
-	resp, err := http.DefaultClient.Do(req)
-	log.Printf("%s %s -> %d %s", req.Method, req.URL, resp.StatusCode, resp.Status)
+	username, password := c.Username, c.Password
+	if c.Credentials != nil {
+		username, password, err = c.Credentials()
+		if err != nil {
+			return fmt.Errorf("failed to obtain ISY credentials: %s", err)
+		}
+	}
+	req.SetBasicAuth(username, password)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
+		c.Logger.Printf("%s %s%s -> %s", req.Method, req.URL, logLabel(label), err)
 		return err
 	}
+	defer resp.Body.Close()
+	c.Logger.Debugf("%s %s%s -> %s", req.Method, req.URL, logLabel(label), resp.Status)
 	if resp.StatusCode >= 400 {
-		return errors.New(resp.Status)
+		return isy.NewHTTPError(resp)
 	}
 	return nil
 }
@@ -348,65 +1425,239 @@ func (c *nsClient) MakeURL(parts ...string) *url.URL {
 	return c.BaseURL.ResolveReference(relURL)
 }
 
+// encodeQuery is like qs.Encode but encodes spaces as %20 rather than as
+// "+", because the ISY does not decode "+" in query strings and so would
+// show it literally, such as in a node's name. All other characters that
+// need escaping, including "+" itself and non-ASCII characters, are
+// percent-encoded as UTF-8.
+func encodeQuery(qs url.Values) string {
+	return strings.ReplaceAll(qs.Encode(), "+", "%20")
+}
+
 func (c *nsClient) FormatAddr(base string) string {
 	return c.AddrPrefix + base
 }
 
-func (c *nsClient) ParseAddr(given string) string {
+// ParseAddr removes the profile's prefix from the given absolute node
+// address. The result is false if the address does not have the prefix,
+// and so does not belong to this profile.
+func (c *nsClient) ParseAddr(given string) (string, bool) {
 	if !strings.HasPrefix(given, c.AddrPrefix) {
-		// Should never happen if the server is behaving
-		return given
+		return "", false
 	}
 
-	return given[len(c.AddrPrefix):]
+	return given[len(c.AddrPrefix):], true
 }
 
 func (c *nsClient) ReportRequestStatus(id string, success bool) error {
+	return c.ReportRequestStatusContext(context.Background(), id, success)
+}
+
+func (c *nsClient) ReportRequestStatusContext(ctx context.Context, id string, success bool) error {
 	var url *url.URL
 	if success {
 		url = c.MakeURL("report", "status", id, "success")
 	} else {
 		url = c.MakeURL("report", "status", id, "fail")
 	}
-	return c.Request(url)
+	return c.RequestContext(ctx, url, "requestId="+id)
 }
 
-func (c *nsClient) AddNode(addr, defId, primaryAddr, name string) error {
-	addr = c.FormatAddr(addr)
-	if primaryAddr != "" {
-		primaryAddr = c.FormatAddr(primaryAddr)
+func (c *nsClient) AddNode(opts AddNodeOptions) error {
+	return c.AddNodeContext(context.Background(), opts)
+}
+
+func (c *nsClient) AddNodeContext(ctx context.Context, opts AddNodeOptions) error {
+	err := ValidateNodeAddr(opts.Addr)
+	if err != nil {
+		return err
 	}
-	url := c.MakeURL("nodes", addr, "add", defId)
+	url := c.MakeURL("nodes", c.FormatAddr(opts.Addr), "add", opts.NodeDefID)
 	qs := url.Query()
-	if primaryAddr != "" {
-		qs.Set("primary", primaryAddr)
+	if opts.Primary != "" {
+		qs.Set("primary", c.FormatAddr(opts.Primary))
 	}
-	if name != "" {
-		qs.Set("name", name)
+	if opts.Name != "" {
+		qs.Set("name", opts.Name)
 	}
-	url.RawQuery = qs.Encode()
+	if opts.Hint != "" {
+		qs.Set("hint", opts.Hint)
+	}
+	url.RawQuery = encodeQuery(qs)
 
+	err = c.RequestContext(ctx, url, "")
+	if err, ok := err.(*isy.HTTPError); ok && err.StatusCode == http.StatusConflict {
+		return ErrNodeExists
+	}
+	return err
+}
+
+func (c *nsClient) RemoveNode(addr string) error {
+	addr = c.FormatAddr(addr)
+	url := c.MakeURL("nodes", addr, "remove")
+	return c.Request(url)
+}
+
+func (c *nsClient) ChangeNodeDef(addr, defId string) error {
+	addr = c.FormatAddr(addr)
+	url := c.MakeURL("nodes", addr, "change", defId)
+	return c.RequestFor(url, "node="+addr)
+}
+
+func (c *nsClient) RenameNode(addr, name string) error {
+	addr = c.FormatAddr(addr)
+	url := c.MakeURL("nodes", addr, "rename")
+	qs := url.Query()
+	qs.Set("name", name)
+	url.RawQuery = encodeQuery(qs)
 	return c.Request(url)
 }
 
+func (c *nsClient) SetNodeEnabled(addr string, enabled bool) error {
+	return c.SetNodeEnabledContext(context.Background(), addr, enabled)
+}
+
+func (c *nsClient) SetNodeEnabledContext(ctx context.Context, addr string, enabled bool) error {
+	addr = c.FormatAddr(addr)
+	var url *url.URL
+	if enabled {
+		url = c.MakeURL("nodes", addr, "enable")
+	} else {
+		url = c.MakeURL("nodes", addr, "disable")
+	}
+	return c.RequestContext(ctx, url, "")
+}
+
+// SetDriver reports a driver value. If prec is greater than zero then it is
+// sent as the number of decimal places in the value, for the ISY to use when
+// displaying it.
+func (c *nsClient) SetDriver(addr, driver, value string, uom isy.UOM, prec int, force bool) error {
+	addr = c.FormatAddr(addr)
+	var url *url.URL
+	if uom == isy.UOMUnknown {
+		url = c.MakeURL("nodes", addr, "report", "status", driver, value)
+	} else {
+		url = c.MakeURL("nodes", addr, "report", "status", driver, value, strconv.Itoa(int(uom)))
+	}
+	qs := url.Query()
+	if force {
+		qs.Set("force", "true")
+	}
+	if prec > 0 {
+		qs.Set("prec", strconv.Itoa(prec))
+	}
+	url.RawQuery = encodeQuery(qs)
+	return c.RequestFor(url, "node="+addr+" driver="+driver)
+}
+
 func (c *nsClient) ReportNodeStatus(addr, field, value string, uom isy.UOM) error {
 	addr = c.FormatAddr(addr)
 	url := c.MakeURL("nodes", addr, "report", "status", field, value, strconv.Itoa(int(uom)))
+	return c.RequestFor(url, "node="+addr+" driver="+field)
+}
+
+func (c *nsClient) ReportCommand(addr, command string, param *CommandParam) error {
+	addr = c.FormatAddr(addr)
+	var url *url.URL
+	switch {
+	case param == nil:
+		url = c.MakeURL("nodes", addr, "report", "cmd", command)
+	case param.UOM == isy.UOMUnknown:
+		url = c.MakeURL("nodes", addr, "report", "cmd", command, param.Value)
+	default:
+		url = c.MakeURL("nodes", addr, "report", "cmd", command, param.Value, strconv.Itoa(int(param.UOM)))
+	}
+	return c.Request(url)
+}
+
+func (c *nsClient) SetCustomParams(params map[string]string) error {
+	url := c.MakeURL("set", "customparams")
+	qs := url.Query()
+	for k, v := range params {
+		qs.Set(k, v)
+	}
+	url.RawQuery = encodeQuery(qs)
 	return c.Request(url)
 }
 
-func init() {
-	router = mux.NewRouter()
+func (c *nsClient) AddNotice(key, text string) error {
+	url := c.MakeURL("notices", key, "add")
+	qs := url.Query()
+	qs.Set("text", text)
+	url.RawQuery = encodeQuery(qs)
+	return c.Request(url)
+}
+
+func (c *nsClient) RemoveNotice(key string) error {
+	url := c.MakeURL("notices", key, "remove")
+	return c.Request(url)
+}
+
+// newRouter creates the router used to recognize the requests the ISY sends
+// to a node server. Each route's name identifies the kind of request.
+func newRouter() *mux.Router {
+	router := mux.NewRouter()
 	router.Path("/ns/install/{profileNum}").Name("install")
 	router.Path("/ns/nodes/{nodeAddr}/query").Name("nodeQuery")
 	router.Path("/ns/nodes/{nodeAddr}/status").Name("nodeStatus")
 	router.Path("/ns/add/nodes").Name("addAllNodes")
+	router.Path("/ns/discover").Name("discover")
 	router.Path("/ns/nodes/{nodeAddr}/report/add/{nodeDefId}").Name("addNode")
 	router.Path("/ns/nodes/{nodeAddr}/report/remove").Name("removeNode")
 	router.Path("/ns/nodes/{nodeAddr}/report/rename").Name("renameNode")
 	router.Path("/ns/nodes/{nodeAddr}/report/enable").Name("enableNode")
 	router.Path("/ns/nodes/{nodeAddr}/report/disable").Name("disableNode")
+	router.Path("/ns/customparams").Name("customParams")
 	router.Path("/ns/nodes/{nodeAddr}/cmd/{command}").Name("nodeCommand")
 	router.Path("/ns/nodes/{nodeAddr}/cmd/{command}/{value}").Name("nodeCommandValue")
 	router.Path("/ns/nodes/{nodeAddr}/cmd/{command}/{value}/{unit}").Name("nodeCommandValueUnit")
+	return router
+}
+
+// routeTemplates returns the path templates of all of the given router's
+// routes, split into segments.
+func routeTemplates(router *mux.Router) [][]string {
+	var ret [][]string
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err == nil {
+			ret = append(ret, strings.Split(tmpl, "/"))
+		}
+		return nil
+	})
+	return ret
+}
+
+// normalizeRoutePath removes any trailing slash from the given path and, if
+// it then matches one of the given templates when ignoring the case of the
+// template's fixed segments, rewrites those segments to match the template
+// exactly. Segments that correspond to variables are left unchanged.
+func normalizeRoutePath(templates [][]string, p string) string {
+	if len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+	segs := strings.Split(p, "/")
+
+Templates:
+	for _, tmpl := range templates {
+		if len(tmpl) != len(segs) {
+			continue
+		}
+		for i, seg := range tmpl {
+			if !strings.HasPrefix(seg, "{") && !strings.EqualFold(seg, segs[i]) {
+				continue Templates
+			}
+		}
+
+		ret := make([]string, len(segs))
+		for i, seg := range tmpl {
+			if strings.HasPrefix(seg, "{") {
+				ret[i] = segs[i]
+			} else {
+				ret[i] = seg
+			}
+		}
+		return strings.Join(ret, "/")
+	}
+	return p
 }
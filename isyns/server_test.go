@@ -0,0 +1,1215 @@
+package isyns
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestNewServerProfileNum(t *testing.T) {
+	tests := []struct {
+		ProfileNum int
+		WantErr    bool
+	}{
+		{-1, true},
+		{0, true},
+		{1, false},
+		{25, false},
+		{26, true},
+	}
+
+	for _, test := range tests {
+		_, err := NewServer(&Config{}, test.ProfileNum, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+		if (err != nil) != test.WantErr {
+			t.Errorf("wrong result for %d\ngot error: %v\nwant error: %v", test.ProfileNum, err, test.WantErr)
+		}
+	}
+}
+
+func TestSplitUOMSuffix(t *testing.T) {
+	tests := []struct {
+		Key      string
+		WantName string
+		WantUOM  isy.UOM
+	}{
+		{"level", "level", isy.UOMUnknown},
+		{"level.uom51", "level", isy.UOMPercent},
+		{"level.uom42", "level", isy.UOMMillisecond},
+		{"foo.uomething", "foo.uomething", isy.UOMUnknown},
+		{"x.uom", "x.uom", isy.UOMUnknown},
+		{"weird.uomx", "weird.uomx", isy.UOMUnknown},
+		{"a.uom1.uom17", "a.uom1", isy.UOMFahrenheit},
+	}
+
+	for _, test := range tests {
+		gotName, gotUOM := splitUOMSuffix(test.Key)
+		if gotName != test.WantName || gotUOM != test.WantUOM {
+			t.Errorf("wrong result for %q\ngot:  %q, %d\nwant: %q, %d", test.Key, gotName, int(gotUOM), test.WantName, int(test.WantUOM))
+		}
+	}
+}
+
+func TestServerMakeCommandParams(t *testing.T) {
+	tests := []struct {
+		Query string
+		Want  map[string]CommandParam
+	}{
+		{"", nil},
+		{"requestId=12", nil},
+		{
+			"level=50",
+			map[string]CommandParam{
+				"level": {Value: "50", Values: []string{"50"}},
+			},
+		},
+		{
+			"level.uom51=50&requestId=12",
+			map[string]CommandParam{
+				"level": {Value: "50", UOM: isy.UOMPercent, Values: []string{"50"}},
+			},
+		},
+		{
+			"level.uomx=50",
+			map[string]CommandParam{
+				"level.uomx": {Value: "50", Values: []string{"50"}},
+			},
+		},
+		{
+			"level.uom99999999999999999999=50",
+			map[string]CommandParam{
+				"level.uom99999999999999999999": {Value: "50", Values: []string{"50"}},
+			},
+		},
+		{
+			"flag&empty=",
+			map[string]CommandParam{
+				"flag":  {Value: "", Values: []string{""}},
+				"empty": {Value: "", Values: []string{""}},
+			},
+		},
+		{
+			"zone.uom25=1&zone.uom25=3",
+			map[string]CommandParam{
+				"zone": {Value: "1", UOM: isy.UOMIndex, Values: []string{"1", "3"}},
+			},
+		},
+		{
+			"name=Living%20Room+Lamp",
+			map[string]CommandParam{
+				"name": {Value: "Living Room Lamp", Values: []string{"Living Room Lamp"}},
+			},
+		},
+	}
+
+	s := &Server{}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/ns/nodes/n001_foo/cmd/DON?"+test.Query, nil)
+		got := s.makeCommandParams(r)
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("wrong result for %q\ngot:  %#v\nwant: %#v", test.Query, got, test.Want)
+		}
+	}
+}
+
+func TestServerStopAccepting(t *testing.T) {
+	s, err := NewServer(&Config{
+		Username: "isy",
+		Password: "secret",
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With nobody reading Requests, this request blocks until we call
+	// StopAccepting below.
+	done := make(chan int)
+	go func() {
+		req := httptest.NewRequest("GET", "/ns/add/nodes?requestId=1", nil)
+		req.SetBasicAuth("isy", "secret")
+		rec := httptest.NewRecorder()
+		s.serveHTTP(rec, req)
+		done <- rec.Code
+	}()
+
+	select {
+	case code := <-done:
+		t.Fatalf("request completed with %d before StopAccepting", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.StopAccepting()
+	if got, want := <-done, 503; got != want {
+		t.Errorf("wrong status for blocked request %d; want %d", got, want)
+	}
+
+	req := httptest.NewRequest("GET", "/ns/add/nodes?requestId=2", nil)
+	req.SetBasicAuth("isy", "secret")
+	rec := httptest.NewRecorder()
+	s.serveHTTP(rec, req)
+	if got, want := rec.Code, 503; got != want {
+		t.Errorf("wrong status for new request %d; want %d", got, want)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Timeout  time.Duration
+		Consume  bool
+		WantErr  error
+		WantCode int
+	}{
+		{"drained", time.Minute, true, nil, 204},
+		{"deadline", 20 * time.Millisecond, false, context.DeadlineExceeded, 503},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			s, err := NewServer(&Config{
+				Reporter: NewRecordingClient(),
+			}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// With nobody reading Requests, this request blocks until it is
+			// either consumed or abandoned by Shutdown.
+			codes := make(chan int)
+			go func() {
+				req := httptest.NewRequest("GET", "/ns/nodes/n001_foo/query?requestId=1", nil)
+				req.SetBasicAuth("", "")
+				rec := httptest.NewRecorder()
+				s.serveHTTP(rec, req)
+				codes <- rec.Code
+			}()
+			deadline := time.Now().Add(5 * time.Second)
+			for len(s.InFlight()) == 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), test.Timeout)
+			defer cancel()
+			errs := make(chan error)
+			go func() {
+				errs <- s.Shutdown(ctx)
+			}()
+
+			if test.Consume {
+				select {
+				case err := <-errs:
+					t.Fatalf("Shutdown returned %v before the pending request was consumed", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+				if _, ok := <-s.Requests; !ok {
+					t.Fatal("Requests closed before the pending request was consumed")
+				}
+			}
+
+			if got := <-errs; got != test.WantErr {
+				t.Errorf("wrong error from Shutdown %v; want %v", got, test.WantErr)
+			}
+			if got := <-codes; got != test.WantCode {
+				t.Errorf("wrong status for pending request %d; want %d", got, test.WantCode)
+			}
+			if _, ok := <-s.Requests; ok {
+				t.Errorf("Requests not closed after Shutdown")
+			}
+		})
+	}
+}
+
+// blockingHandler is a Handler whose HandleCommand blocks until released,
+// ignoring the request's context.
+type blockingHandler struct {
+	BaseHandler
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h blockingHandler) HandleCommand(req *CommandRequest) {
+	h.entered <- struct{}{}
+	<-h.release
+}
+
+func TestServerShutdownBlockingHandler(t *testing.T) {
+	h := blockingHandler{
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	s, err := NewServer(&Config{
+		Handler:  h,
+		Reporter: NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		req := httptest.NewRequest("GET", "/ns/nodes/n001_relay/cmd/DON?requestId=1", nil)
+		req.SetBasicAuth("", "")
+		s.serveHTTP(httptest.NewRecorder(), req)
+	}()
+	<-h.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errs := make(chan error)
+	go func() {
+		errs <- s.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-errs:
+		if err != context.DeadlineExceeded {
+			t.Errorf("wrong error from Shutdown %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after its deadline while a handler was blocked")
+	}
+	if _, ok := <-s.Requests; ok {
+		t.Errorf("Requests not closed after Shutdown")
+	}
+
+	// The handler is left running, and can still finish afterwards.
+	close(h.release)
+	<-served
+}
+
+type addAllNodesHandler struct {
+	BaseHandler
+	got []*AddAllNodesRequest
+}
+
+func (h *addAllNodesHandler) HandleAddAllNodes(req *AddAllNodesRequest) {
+	h.got = append(h.got, req)
+}
+
+func TestServerDiscover(t *testing.T) {
+	h := &addAllNodesHandler{}
+	s, err := NewServer(&Config{
+		Handler: h,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/ns/add/nodes", "/ns/discover"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.SetBasicAuth("", "")
+		rec := httptest.NewRecorder()
+		s.serveHTTP(rec, req)
+		if got, want := rec.Code, 204; got != want {
+			t.Errorf("wrong status for %s %d; want %d", path, got, want)
+		}
+	}
+
+	if len(h.got) != 2 {
+		t.Fatalf("got %d requests; want 2", len(h.got))
+	}
+	if h.got[0].Discover {
+		t.Errorf("add nodes request is marked as discovery")
+	}
+	if !h.got[1].Discover {
+		t.Errorf("discover request is not marked as discovery")
+	}
+}
+
+func TestServerCustomParams(t *testing.T) {
+	s, err := NewServer(&Config{
+		RequestBufferSize: 1,
+		Reporter:          NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.NewReader(`{"host":"192.168.1.20","port":"8080"}`)
+	r := httptest.NewRequest("POST", "/ns/customparams?requestId=7&port=80&user=admin", body)
+	r.SetBasicAuth("", "")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, r)
+	if got, want := rec.Code, 204; got != want {
+		t.Fatalf("wrong status %d; want %d", got, want)
+	}
+
+	req, ok := (<-s.Requests).(*CustomParamsRequest)
+	if !ok {
+		t.Fatalf("wrong request type")
+	}
+	want := map[string]string{
+		"host": "192.168.1.20",
+		"port": "8080",
+		"user": "admin",
+	}
+	if !reflect.DeepEqual(req.Params, want) {
+		t.Errorf("wrong params\ngot:  %#v\nwant: %#v", req.Params, want)
+	}
+
+	r = httptest.NewRequest("POST", "/ns/customparams?requestId=8", strings.NewReader(`{"port":8080}`))
+	r.SetBasicAuth("", "")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, r)
+	if got, want := rec.Code, 404; got != want {
+		t.Errorf("wrong status for invalid body %d; want %d", got, want)
+	}
+}
+
+// panickingHandler panics while handling the command BOOM.
+type panickingHandler struct {
+	BaseHandler
+}
+
+func (panickingHandler) HandleCommand(req *CommandRequest) {
+	if req.Command == "BOOM" {
+		panic("boom")
+	}
+	req.Complete(true)
+}
+
+func TestServerRecoverPanic(t *testing.T) {
+	logger := &testLogger{}
+	s, err := NewServer(&Config{
+		Handler:  panickingHandler{},
+		Logger:   logger,
+		Reporter: NewRecordingClient(),
+		Responder: func(req Request, w http.ResponseWriter) bool {
+			if req.(*CommandRequest).Command == "EARLY" {
+				panic("early")
+			}
+			return false
+		},
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path       string
+		WantStatus int
+		WantLog    string
+	}{
+		// A panic before the request is acknowledged results in an error
+		// response.
+		{
+			"/ns/nodes/n001_sw/cmd/EARLY?requestId=1",
+			500,
+			"panic while handling GET /ns/nodes/n001_sw/cmd/EARLY: early\n",
+		},
+		// The handler is called after the request is acknowledged, so the
+		// ISY has already been told that it was accepted.
+		{
+			"/ns/nodes/n001_sw/cmd/BOOM?requestId=2",
+			204,
+			"panic while handling GET /ns/nodes/n001_sw/cmd/BOOM: boom\n",
+		},
+		// The server keeps serving after a panic.
+		{
+			"/ns/nodes/n001_sw/cmd/DON?requestId=3",
+			204,
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		logger.mu.Lock()
+		logger.lines = nil
+		logger.mu.Unlock()
+
+		r := httptest.NewRequest("GET", test.Path, nil)
+		r.SetBasicAuth("", "")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, r)
+		if got := rec.Code; got != test.WantStatus {
+			t.Errorf("wrong status for %s %d; want %d", test.Path, got, test.WantStatus)
+		}
+
+		logger.mu.Lock()
+		var panics []string
+		for _, line := range logger.lines {
+			if strings.HasPrefix(line, "panic while handling") {
+				panics = append(panics, line)
+			}
+		}
+		logger.mu.Unlock()
+		switch {
+		case test.WantLog == "" && len(panics) != 0:
+			t.Errorf("unexpected panic logged for %s: %#v", test.Path, panics)
+		case test.WantLog != "" && (len(panics) != 1 || !strings.HasPrefix(panics[0], test.WantLog)):
+			t.Errorf("wrong panic logged for %s\ngot:  %#v\nwant: %q", test.Path, panics, test.WantLog)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Errorf("Shutdown after panic failed: %s", err)
+	}
+}
+
+func TestNormalizeRoutePath(t *testing.T) {
+	templates := routeTemplates(newRouter())
+
+	tests := []struct {
+		Path string
+		Want string
+	}{
+		{"/ns/nodes/foo/query", "/ns/nodes/foo/query"},
+		{"/ns/nodes/foo/query/", "/ns/nodes/foo/query"},
+		{"/NS/Nodes/foo/QUERY", "/ns/nodes/foo/query"},
+		{"/ns/nodes/Foo/cmd/DON/", "/ns/nodes/Foo/cmd/DON"},
+		{"/ns/nodes/foo/cmd/query", "/ns/nodes/foo/cmd/query"},
+		{"/ns/unknown/", "/ns/unknown"},
+		{"/", "/"},
+	}
+
+	for _, test := range tests {
+		if got := normalizeRoutePath(templates, test.Path); got != test.Want {
+			t.Errorf("wrong result for %s\ngot:  %s\nwant: %s", test.Path, got, test.Want)
+		}
+	}
+}
+
+func TestServerUnrecognized(t *testing.T) {
+	var got []UnrecognizedRequest
+	s, err := NewServer(&Config{
+		OnUnrecognized: func(req UnrecognizedRequest) {
+			got = append(got, req)
+		},
+		Logger: stdLogger{log.New(ioutil.Discard, "", 0)},
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{
+		"/ns/unknown?a=b",
+		"/ns/nodes/n001_foo/cmd/DON/100/percent",
+		"/ns/install/3",
+		"/ns/nodes/n002_foo/query",
+		"/ns/nodes/n001_foo/report/add/switch?primary=n002_bar",
+	}
+	for _, path := range paths {
+		req := httptest.NewRequest("GET", path, nil)
+		req.SetBasicAuth("", "")
+		rec := httptest.NewRecorder()
+		s.serveHTTP(rec, req)
+		if got, want := rec.Code, 404; got != want {
+			t.Errorf("wrong status for %s %d; want %d", path, got, want)
+		}
+	}
+
+	want := []UnrecognizedRequest{
+		{Method: "GET", Path: "/ns/unknown", RawQuery: "a=b", Reason: "no matching route"},
+		{Method: "GET", Path: "/ns/nodes/n001_foo/cmd/DON/100/percent", Reason: `invalid unit of measure "percent"`},
+		{Method: "GET", Path: "/ns/install/3", Reason: "profile 3 is not served by this server"},
+		{Method: "GET", Path: "/ns/nodes/n002_foo/query", Reason: `node address "n002_foo" does not belong to a profile served by this server`},
+		{Method: "GET", Path: "/ns/nodes/n001_foo/report/add/switch", RawQuery: "primary=n002_bar", Reason: `primary node address "n002_bar" does not belong to profile 1`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestServerResponder(t *testing.T) {
+	s, err := NewServer(&Config{
+		Handler: BaseHandler{},
+		Responder: func(req Request, w http.ResponseWriter) bool {
+			if _, ok := req.(*InstallRequest); !ok {
+				return false
+			}
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(`<installed/>`))
+			return true
+		},
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path     string
+		WantCode int
+		WantBody string
+	}{
+		{"/ns/install/1", 200, `<installed/>`},
+		{"/ns/nodes/n001_foo/query", 204, ``},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.Path, nil)
+		req.SetBasicAuth("", "")
+		rec := httptest.NewRecorder()
+		s.serveHTTP(rec, req)
+		if got := rec.Code; got != test.WantCode {
+			t.Errorf("wrong status for %s %d; want %d", test.Path, got, test.WantCode)
+		}
+		if got := rec.Body.String(); got != test.WantBody {
+			t.Errorf("wrong body for %s %q; want %q", test.Path, got, test.WantBody)
+		}
+	}
+}
+
+func TestServerPathPrefix(t *testing.T) {
+	h := &addAllNodesHandler{}
+	s, err := NewServer(&Config{
+		Handler:    h,
+		Logger:     &testLogger{},
+		PathPrefix: "/isy/ns1/",
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddProfile(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Handler  http.Handler
+		Path     string
+		WantCode int
+	}{
+		{s, "/isy/ns1/ns/add/nodes", 204},
+		{s, "/isy/ns1/ns/discover/", 204},
+		{s.ProfileHandler(2), "/isy/ns1/ns/add/nodes", 204},
+		{s, "/ns/add/nodes", 404},
+		{s, "/isy/ns/add/nodes", 404},
+		{s.ProfileHandler(2), "/ns/add/nodes", 404},
+	}
+
+	for _, test := range tests {
+		h.got = nil
+		req := httptest.NewRequest("GET", test.Path, nil)
+		req.SetBasicAuth("", "")
+		rec := httptest.NewRecorder()
+		test.Handler.ServeHTTP(rec, req)
+		if got := rec.Code; got != test.WantCode {
+			t.Errorf("wrong status for %s %d; want %d", test.Path, got, test.WantCode)
+		}
+		wantReqs := 0
+		if test.WantCode == 204 {
+			wantReqs = 1
+		}
+		if len(h.got) != wantReqs {
+			t.Errorf("got %d requests for %s; want %d", len(h.got), test.Path, wantReqs)
+		}
+	}
+}
+
+func TestServerProfileHandler(t *testing.T) {
+	h := &addAllNodesHandler{}
+	s, err := NewServer(&Config{
+		Handler: h,
+		Logger:  &testLogger{},
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddProfile(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Handler     http.Handler
+		Path        string
+		WantCode    int
+		WantProfile int
+	}{
+		{s, "/ns/add/nodes", 204, 1},
+		{s.ProfileHandler(2), "/ns/add/nodes", 204, 2},
+		{s.ProfileHandler(2), "/ns/discover/", 204, 2},
+		{s.ProfileHandler(3), "/ns/add/nodes", 404, 0},
+		{s.ProfileHandler(2), "/ns/nodes/n001_foo/query", 404, 0},
+	}
+
+	for _, test := range tests {
+		h.got = nil
+		req := httptest.NewRequest("GET", test.Path, nil)
+		req.SetBasicAuth("", "")
+		rec := httptest.NewRecorder()
+		test.Handler.ServeHTTP(rec, req)
+		if got := rec.Code; got != test.WantCode {
+			t.Errorf("wrong status for %s %d; want %d", test.Path, got, test.WantCode)
+			continue
+		}
+		if test.WantProfile == 0 {
+			continue
+		}
+		if len(h.got) != 1 {
+			t.Errorf("got %d requests for %s; want 1", len(h.got), test.Path)
+			continue
+		}
+		if got := h.got[0].ProfileNum(); got != test.WantProfile {
+			t.Errorf("wrong profile for %s %d; want %d", test.Path, got, test.WantProfile)
+		}
+	}
+}
+
+func TestServerServeProfile(t *testing.T) {
+	s, err := NewServer(&Config{
+		RequestBufferSize: 1,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ListenAndServeProfile(2, "127.0.0.1:0"); err == nil {
+		t.Fatal("serving a profile that was not added succeeded")
+	}
+	err = s.AddProfile(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ServeProfile(2, l)
+	}()
+
+	req, _ := http.NewRequest("GET", "http://"+l.Addr().String()+"/ns/add/nodes", nil)
+	req.SetBasicAuth("", "")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, 204; got != want {
+		t.Fatalf("wrong status %d; want %d", got, want)
+	}
+	if got, want := (<-s.Requests).ProfileNum(), 2; got != want {
+		t.Errorf("wrong profile %d; want %d", got, want)
+	}
+
+	err = s.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("wrong result from ServeProfile: %v", err)
+	}
+}
+
+func TestServerInFlight(t *testing.T) {
+	s, err := NewServer(&Config{
+		RequestBufferSize: 2,
+		Reporter:          NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/ns/nodes/n001_foo/query?requestId=1", "/ns/nodes/n001_foo/query?requestId=2"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.SetBasicAuth("", "")
+		s.serveHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got, want := s.InFlight(), []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong in-flight requests before completion\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	req := <-s.Requests
+	err = req.Complete(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.InFlight(), []string{"2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong in-flight requests after completion\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+type countingHandler struct {
+	BaseHandler
+	mu       sync.Mutex
+	commands int
+}
+
+func (h *countingHandler) HandleCommand(req *CommandRequest) {
+	h.mu.Lock()
+	h.commands++
+	h.mu.Unlock()
+	req.Complete(true)
+}
+
+func TestServerDedup(t *testing.T) {
+	tests := []struct {
+		Name         string
+		Window       time.Duration
+		WantCommands int
+		WantReports  int
+	}{
+		{"disabled", 0, 2, 2},
+		{"enabled", time.Minute, 1, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			h := &countingHandler{}
+			rec := NewRecordingClient()
+			s, err := NewServer(&Config{
+				Handler:     h,
+				Reporter:    rec,
+				DedupWindow: test.Window,
+			}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest("GET", "/ns/nodes/n001_relay/cmd/DON?requestId=9", nil)
+				req.SetBasicAuth("", "")
+				resp := httptest.NewRecorder()
+				s.serveHTTP(resp, req)
+				if got, want := resp.Code, 204; got != want {
+					t.Errorf("wrong status for delivery %d: %d; want %d", i, got, want)
+				}
+			}
+
+			if got := h.commands; got != test.WantCommands {
+				t.Errorf("handler received %d commands; want %d", got, test.WantCommands)
+			}
+			want := RecordedCall{ProfileNum: 1, Parts: []string{"report", "status", "9", "success"}, Query: url.Values{}}
+			calls := rec.Calls()
+			if len(calls) != test.WantReports {
+				t.Fatalf("wrong number of reports %d; want %d\n%#v", len(calls), test.WantReports, calls)
+			}
+			for _, got := range calls {
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("wrong report\ngot:  %#v\nwant: %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+// flakyReporter is a Reporter that fails the given number of reports before
+// recording the rest in its RecordingClient.
+type flakyReporter struct {
+	*RecordingClient
+	mu       sync.Mutex
+	failures int
+}
+
+func (r *flakyReporter) Report(u *url.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("ISY unavailable")
+	}
+	return r.RecordingClient.Report(u)
+}
+
+func TestServerDedupReportFailed(t *testing.T) {
+	h := &countingHandler{}
+	rec := &flakyReporter{RecordingClient: NewRecordingClient(), failures: 1}
+	s, err := NewServer(&Config{
+		Handler:     h,
+		Reporter:    rec,
+		Logger:      &testLogger{},
+		DedupWindow: time.Minute,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The outcome of the first delivery can't be reported, but it is still
+	// retained, so each repeated delivery reports it again rather than
+	// being handled again.
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/ns/nodes/n001_relay/cmd/DON?requestId=9", nil)
+		req.SetBasicAuth("", "")
+		s.serveHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got, want := h.commands, 1; got != want {
+		t.Errorf("handler received %d commands; want %d", got, want)
+	}
+	report := RecordedCall{ProfileNum: 1, Parts: []string{"report", "status", "9", "success"}, Query: url.Values{}}
+	if got, want := rec.Calls(), []RecordedCall{report, report}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong reports\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+// blockingReporter is a Reporter whose first report blocks until release
+// is closed.
+type blockingReporter struct {
+	*RecordingClient
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (r *blockingReporter) Report(u *url.URL) error {
+	first := false
+	r.once.Do(func() { first = true })
+	if first {
+		close(r.entered)
+		<-r.release
+	}
+	return r.RecordingClient.Report(u)
+}
+
+func TestServerDedupWhileReporting(t *testing.T) {
+	h := &countingHandler{}
+	rec := &blockingReporter{
+		RecordingClient: NewRecordingClient(),
+		entered:         make(chan struct{}),
+		release:         make(chan struct{}),
+	}
+	s, err := NewServer(&Config{
+		Handler:     h,
+		Reporter:    rec,
+		DedupWindow: time.Minute,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliver := func() {
+		req := httptest.NewRequest("GET", "/ns/nodes/n001_relay/cmd/DON?requestId=9", nil)
+		req.SetBasicAuth("", "")
+		s.serveHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The first delivery is handled, and its report blocks.
+	first := make(chan struct{})
+	go func() {
+		deliver()
+		close(first)
+	}()
+	<-rec.entered
+
+	// The ISY delivers the request again while the report is being sent,
+	// which must report the same outcome rather than handle it again.
+	deliver()
+	close(rec.release)
+	<-first
+
+	h.mu.Lock()
+	commands := h.commands
+	h.mu.Unlock()
+	if got, want := commands, 1; got != want {
+		t.Errorf("handler received %d commands; want %d", got, want)
+	}
+	report := RecordedCall{ProfileNum: 1, Parts: []string{"report", "status", "9", "success"}, Query: url.Values{}}
+	if got, want := rec.Calls(), []RecordedCall{report, report}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong reports\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestServerEndpoints(t *testing.T) {
+	s, err := NewServer(&Config{}, 3, &isy.ClientConfig{BaseURL: "http://192.168.1.5:8080/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddProfile(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.ReportBaseURL().String(), "http://192.168.1.5:8080/rest/ns/3/"; got != want {
+		t.Errorf("wrong report base URL %q; want %q", got, want)
+	}
+	if got, want := s.AddrPrefix(), "n003_"; got != want {
+		t.Errorf("wrong address prefix %q; want %q", got, want)
+	}
+	if got, want := s.Profile(12).ReportBaseURL().String(), "http://192.168.1.5:8080/rest/ns/12/"; got != want {
+		t.Errorf("wrong report base URL for profile 12 %q; want %q", got, want)
+	}
+
+	s.ReportBaseURL().Path = "/modified"
+	if got, want := s.ReportBaseURL().Path, "/rest/ns/3/"; got != want {
+		t.Errorf("report base URL was modified to %q", got)
+	}
+}
+
+type stuckHandler struct {
+	BaseHandler
+	reqs chan *CommandRequest
+}
+
+func (h stuckHandler) HandleCommand(req *CommandRequest) {
+	h.reqs <- req
+}
+
+func TestServerCompleteTimeout(t *testing.T) {
+	h := stuckHandler{reqs: make(chan *CommandRequest, 1)}
+	rec := NewRecordingClient()
+	logger := &testLogger{}
+	s, err := NewServer(&Config{
+		Handler:         h,
+		Reporter:        rec,
+		Logger:          logger,
+		CompleteTimeout: 10 * time.Millisecond,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/ns/nodes/n001_relay/cmd/DON?requestId=3", nil)
+	r.SetBasicAuth("", "")
+	s.serveHTTP(httptest.NewRecorder(), r)
+	req := <-h.reqs
+
+	want := []RecordedCall{
+		{ProfileNum: 1, Parts: []string{"report", "status", "3", "fail"}, Query: url.Values{}},
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.Calls()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong reports after timeout\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got := s.InFlight(); len(got) != 0 {
+		t.Errorf("request still in flight after timeout: %#v", got)
+	}
+
+	// Completing the request late must not report a second outcome.
+	err = req.Complete(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong reports after late completion\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestServerCompleteTimeoutRetention(t *testing.T) {
+	h := stuckHandler{reqs: make(chan *CommandRequest, 2)}
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		Handler:         h,
+		Reporter:        rec,
+		Logger:          &testLogger{},
+		CompleteTimeout: 5 * time.Millisecond,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.timedOutRetention = 20 * time.Millisecond
+
+	// Neither request is ever completed, so the record that the first one
+	// timed out must be discarded once it is older than the retention
+	// period, rather than being retained forever.
+	for i, id := range []string{"1", "2"} {
+		if i > 0 {
+			time.Sleep(30 * time.Millisecond)
+		}
+		r := httptest.NewRequest("GET", "/ns/nodes/n001_relay/cmd/DON?requestId="+id, nil)
+		r.SetBasicAuth("", "")
+		s.serveHTTP(httptest.NewRecorder(), r)
+		deadline := time.Now().Add(5 * time.Second)
+		for len(rec.Calls()) <= i && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	s.pendingMu.Lock()
+	got := make([]string, 0, len(s.timedOut))
+	for id := range s.timedOut {
+		got = append(got, id)
+	}
+	s.pendingMu.Unlock()
+	if want := []string{"2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong timed out requests retained\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestServerSetReady(t *testing.T) {
+	s, err := NewServer(&Config{
+		RequestBufferSize: 10,
+		Reporter:          NewRecordingClient(),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Ready    bool
+		Path     string
+		WantCode int
+	}{
+		{true, "/ns/nodes/n001_foo/cmd/DON", 204},
+		{false, "/ns/nodes/n001_foo/cmd/DON", 503},
+		{false, "/ns/nodes/n001_foo/query", 503},
+		{false, "/ns/nodes/n001_foo/status", 503},
+		{false, "/ns/install/1", 204},
+		{false, "/ns/nodes/n001_foo/report/add/switch", 204},
+		{false, "/ns/add/nodes", 204},
+		{true, "/ns/nodes/n001_foo/query", 204},
+	}
+
+	for _, test := range tests {
+		s.SetReady(test.Ready)
+		req := httptest.NewRequest("GET", test.Path, nil)
+		req.SetBasicAuth("", "")
+		rec := httptest.NewRecorder()
+		s.serveHTTP(rec, req)
+		if got := rec.Code; got != test.WantCode {
+			t.Errorf("wrong status for %s with ready=%t: %d; want %d", test.Path, test.Ready, got, test.WantCode)
+		}
+	}
+}
+
+func TestServerAdmin(t *testing.T) {
+	s, err := NewServer(&Config{
+		Username:        "isy",
+		Password:        "secret",
+		AdminListenAddr: "127.0.0.1:0",
+		AdminHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("metrics"))
+		}),
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		s.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := get("/healthz"); code != 200 || body != "ok\n" {
+		t.Errorf("wrong health response %d %q; want 200", code, body)
+	}
+	if code, body := get("/metrics"); code != 200 || body != "metrics" {
+		t.Errorf("wrong metrics response %d %q; want 200", code, body)
+	}
+
+	s.SetReady(false)
+	if code, body := get("/healthz"); code != 503 || body != "not ready\n" {
+		t.Errorf("wrong health response when not ready %d %q; want 503", code, body)
+	}
+
+	// The ISY-facing endpoints are not served on the admin handler, so
+	// their paths are passed to Config.AdminHandler instead.
+	if _, body := get("/ns/install/1"); body != "metrics" {
+		t.Errorf("admin handler served ISY request with body %q", body)
+	}
+}
+
+func TestServerListenAndServeAdminUnconfigured(t *testing.T) {
+	s, err := NewServer(&Config{}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ListenAndServeAdmin(); err == nil {
+		t.Errorf("ListenAndServeAdmin succeeded without an admin address")
+	}
+}
+
+func TestServerListenAndServeUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isyns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ns.sock")
+
+	// Leave a stale socket behind, as a process that crashed would.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	rec := NewRecordingClient()
+	s, err := NewServer(&Config{
+		RequestBufferSize: 1,
+		Reporter:          rec,
+	}, 1, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ListenAndServeUnix(path)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	var resp *http.Response
+	for i := 0; ; i++ {
+		req, _ := http.NewRequest("GET", "http://isyns/ns/nodes/n001_sw/query?requestId=5", nil)
+		req.SetBasicAuth("", "")
+		resp, err = client.Do(req)
+		if err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, 204; got != want {
+		t.Fatalf("wrong status %d; want %d", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(unixSocketMode); got != want {
+		t.Errorf("wrong socket permissions %s; want %s", got, want)
+	}
+
+	req := <-s.Requests
+	err = req.Complete(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RecordedCall{
+		{
+			ProfileNum: 1,
+			Parts:      []string{"report", "status", "5", "success"},
+			Query:      map[string][]string{},
+		},
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong reports\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	err = s.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("wrong result from ListenAndServeUnix: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket was not removed: %v", err)
+	}
+}
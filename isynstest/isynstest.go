@@ -0,0 +1,128 @@
+// Package isynstest provides utilities for testing node servers built with
+// package isyns, by simulating the requests that the ISY sends to a node
+// server without the need for a real ISY or a network listener.
+package isynstest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/apparentlymart/go-isy/isy"
+	"github.com/apparentlymart/go-isy/isyns"
+)
+
+// ISY simulates an ISY making requests to a node server.
+//
+// Each request passes through the server's usual request handling,
+// including authentication, address prefixing and parameter parsing, but
+// is made in-process rather than over the network. Requests are delivered
+// to the server's Handler if it has one, in which case the handler has
+// returned by the time the method returns, or to its Requests channel
+// otherwise. In the latter case each method blocks until the request is
+// read from the channel, as the real ISY would, so tests must either read
+// Requests concurrently or set Config.RequestBufferSize.
+//
+// Node addresses given to the methods of ISY are relative to the server's
+// primary profile. Each method returns the requestId it sent, which can be
+// used to check the outcome reported by the node server, such as with an
+// isyns.RecordingClient.
+type ISY struct {
+	Server *isyns.Server
+
+	// Username and Password are the credentials sent with each request,
+	// which must match those in the server's Config.
+	Username string
+	Password string
+
+	// PathPrefix must match the server's Config.PathPrefix, if any.
+	PathPrefix string
+
+	mu     sync.Mutex
+	nextID int
+}
+
+// Install simulates the ISY installing the node server in the given
+// profile slot.
+func (i *ISY) Install(profileNum int) (string, error) {
+	return i.Do(nil, "install", strconv.Itoa(profileNum))
+}
+
+// Query simulates the ISY asking for the given node's current driver
+// values to be reported.
+func (i *ISY) Query(addr string) (string, error) {
+	return i.Do(nil, "nodes", i.Server.FormatAddr(addr), "query")
+}
+
+// Status simulates the ISY requesting the status values of the given node.
+func (i *ISY) Status(addr string) (string, error) {
+	return i.Do(nil, "nodes", i.Server.FormatAddr(addr), "status")
+}
+
+// AddAllNodes simulates the ISY asking the node server to add all of its
+// nodes.
+func (i *ISY) AddAllNodes() (string, error) {
+	return i.Do(nil, "add", "nodes")
+}
+
+// Discover simulates the user asking the node server to discover new
+// devices.
+func (i *ISY) Discover() (string, error) {
+	return i.Do(nil, "discover")
+}
+
+// Command simulates the ISY sending a command with no main parameter to
+// the given node, with the given additional parameters, if any.
+//
+// Each parameter may include a unit suffix in the form the ISY uses, such
+// as "temp.uom17".
+func (i *ISY) Command(addr, command string, params url.Values) (string, error) {
+	return i.Do(params, "nodes", i.Server.FormatAddr(addr), "cmd", command)
+}
+
+// CommandValue simulates the ISY sending a command with a main parameter
+// value in the given unit to the given node.
+func (i *ISY) CommandValue(addr, command, value string, uom isy.UOM, params url.Values) (string, error) {
+	return i.Do(params, "nodes", i.Server.FormatAddr(addr), "cmd", command, value, strconv.Itoa(int(uom)))
+}
+
+// Do simulates the ISY making a request to the given path, relative to the
+// node server's base path, with the given query arguments. A requestId
+// argument is added automatically and returned.
+//
+// This is for request types that have no more specific method.
+func (i *ISY) Do(query url.Values, parts ...string) (string, error) {
+	i.mu.Lock()
+	i.nextID++
+	id := strconv.Itoa(i.nextID)
+	i.mu.Unlock()
+
+	escaped := make([]string, len(parts))
+	for n, part := range parts {
+		escaped[n] = url.PathEscape(part)
+	}
+	u := &url.URL{
+		Path:    path.Join(append([]string{"/", i.PathPrefix, "ns"}, parts...)...),
+		RawPath: path.Join(append([]string{"/", i.PathPrefix, "ns"}, escaped...)...),
+	}
+	qs := url.Values{}
+	for k, vs := range query {
+		qs[k] = vs
+	}
+	qs.Set("requestId", id)
+	u.RawQuery = qs.Encode()
+
+	req := httptest.NewRequest("GET", u.String(), nil)
+	req.SetBasicAuth(i.Username, i.Password)
+	rec := httptest.NewRecorder()
+	i.Server.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent && rec.Code != http.StatusOK {
+		return id, fmt.Errorf("node server responded with %d %s", rec.Code, http.StatusText(rec.Code))
+	}
+	return id, nil
+}
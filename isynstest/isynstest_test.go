@@ -0,0 +1,59 @@
+package isynstest
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/apparentlymart/go-isy/isy"
+	"github.com/apparentlymart/go-isy/isyns"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestISY(t *testing.T) {
+	s, err := isyns.NewServer(&isyns.Config{
+		Username:          "isy",
+		Password:          "secret",
+		RequestBufferSize: 4,
+		Reporter:          isyns.NewRecordingClient(),
+	}, 2, &isy.ClientConfig{BaseURL: "http://127.0.0.1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim := &ISY{
+		Server:   s,
+		Username: "isy",
+		Password: "secret",
+	}
+
+	id, err := sim.CommandValue("tstat", "CLISPH", "68.5", isy.UOMFahrenheit, url.Values{"fan.uom25": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1" {
+		t.Errorf("wrong request id %q; want \"1\"", id)
+	}
+
+	req := (<-s.Requests).(*isyns.CommandRequest)
+	got := []interface{}{req.ID(), req.ProfileNum(), req.NodeAddr, req.Command, req.Param, req.Params}
+	want := []interface{}{
+		"1",
+		2,
+		"tstat",
+		"CLISPH",
+		&isyns.CommandParam{Value: "68.5", UOM: isy.UOMFahrenheit, Values: []string{"68.5"}},
+		map[string]isyns.CommandParam{
+			"fan": {Value: "1", UOM: isy.UOMIndex, Values: []string{"1"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong request\ngot:  %s\nwant: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	sim.Password = "wrong"
+	_, err = sim.Query("tstat")
+	if err == nil {
+		t.Errorf("request with wrong password succeeded")
+	}
+}
@@ -0,0 +1,9 @@
+// Package profile contains types for describing the "profile" of an ISY
+// node server: the node types it provides, the drivers and commands each
+// node type supports, and the editors that describe the values those
+// drivers and command parameters may take.
+//
+// The ISY expects a profile to be provided as a zip archive containing
+// XML and text files in a particular layout. Use Profile.WriteZip to
+// produce such an archive.
+package profile
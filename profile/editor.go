@@ -0,0 +1,119 @@
+package profile
+
+import (
+	"encoding/xml"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+// Editor describes the values that a driver or command parameter may take.
+type Editor struct {
+	ID     string   `xml:"id,attr"`
+	Ranges []*Range `xml:"range"`
+}
+
+// AddRange adds a range of numeric values to the editor, returning it so
+// that other settings such as Prec can be adjusted.
+func (e *Editor) AddRange(uom isy.UOM, min, max, step float64) *Range {
+	r := &Range{
+		UOM:  uom,
+		Min:  min,
+		Max:  max,
+		Step: step,
+	}
+	e.Ranges = append(e.Ranges, r)
+	return r
+}
+
+// AddSubset adds a range permitting only the given values, typically of an
+// index unit, returning it so that its NLS prefix can be set. The order of
+// the given values is not significant.
+func (e *Editor) AddSubset(uom isy.UOM, values []int) *Range {
+	r := &Range{
+		UOM:    uom,
+		Subset: formatSubset(values),
+	}
+	e.Ranges = append(e.Ranges, r)
+	return r
+}
+
+// Range describes a set of values in a particular unit of measure.
+type Range struct {
+	UOM isy.UOM `xml:"uom,attr"`
+
+	// Min and Max are ignored if Subset is set.
+	Min  float64 `xml:"min,attr"`
+	Max  float64 `xml:"max,attr"`
+	Prec int     `xml:"prec,attr,omitempty"`
+	Step float64 `xml:"step,attr,omitempty"`
+
+	// Subset restricts the permitted values to a list of values and
+	// ranges, such as "0-3,5". This is used for index values.
+	Subset string `xml:"subset,attr,omitempty"`
+
+	// NLS is the prefix used to look up localized names for each of the
+	// values in the range, for index values.
+	NLS string `xml:"nls,attr,omitempty"`
+}
+
+func (r *Range) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	attr := func(name, value string) {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+	}
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	attr("uom", strconv.Itoa(int(r.UOM)))
+	if r.Subset != "" {
+		attr("subset", r.Subset)
+	} else {
+		attr("min", formatFloat(r.Min))
+		attr("max", formatFloat(r.Max))
+	}
+	if r.Prec != 0 {
+		attr("prec", strconv.Itoa(r.Prec))
+	}
+	if r.Step != 0 {
+		attr("step", formatFloat(r.Step))
+	}
+	if r.NLS != "" {
+		attr("nls", r.NLS)
+	}
+
+	err := e.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// formatSubset formats the given values in the ISY's subset syntax,
+// collapsing runs of consecutive values into ranges.
+func formatSubset(values []int) string {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if sorted[i] == sorted[j] {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(sorted[i])+"-"+strconv.Itoa(sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+type editorsDoc struct {
+	XMLName struct{}  `xml:"editors"`
+	Editors []*Editor `xml:"editor"`
+}
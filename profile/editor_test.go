@@ -0,0 +1,38 @@
+package profile
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/diff"
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestEditorsXML(t *testing.T) {
+	temp := &Editor{ID: "TEMP"}
+	temp.AddRange(isy.UOMFahrenheit, -40, 120, 0.5).Prec = 1
+
+	mode := &Editor{ID: "MODE"}
+	mode.AddSubset(isy.UOMIndex, []int{5, 0, 1, 2, 3, 3}).NLS = "MODE"
+
+	got, err := xml.MarshalIndent(&editorsDoc{Editors: []*Editor{temp, mode}}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.TrimSpace(`
+<editors>
+  <editor id="TEMP">
+    <range uom="17" min="-40" max="120" prec="1" step="0.5"></range>
+  </editor>
+  <editor id="MODE">
+    <range uom="25" subset="0-3,5" nls="MODE"></range>
+  </editor>
+</editors>
+`)
+
+	if string(got) != want {
+		t.Errorf("wrong result\n%s", diff.LineDiff(want, string(got)))
+	}
+}
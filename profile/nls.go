@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// NLS holds the English text for the symbolic names used in a profile,
+// and is written as the profile's nls/en_us.txt file.
+//
+// The keys are formed from the NLS prefixes given in NodeDef.NLS and
+// Range.NLS, so the methods that add entries take the same prefixes to keep
+// the two consistent.
+type NLS map[string]string
+
+// NodeName sets the display name of nodes of the node definition with the
+// given ID.
+func (n NLS) NodeName(nodeDefID, name string) {
+	n["ND-"+nodeDefID+"-NAME"] = name
+}
+
+// DriverLabel sets the display name of a driver for node definitions with
+// the given NLS prefix.
+func (n NLS) DriverLabel(nls, driver, label string) {
+	n["ST-"+nls+"-"+driver+"-NAME"] = label
+}
+
+// CommandLabel sets the display name of a command for node definitions
+// with the given NLS prefix.
+func (n NLS) CommandLabel(nls, command, label string) {
+	n["CMD-"+nls+"-"+command+"-NAME"] = label
+}
+
+// CommandParamLabel sets the display name of a command parameter for node
+// definitions with the given NLS prefix.
+func (n NLS) CommandParamLabel(nls, command, param, label string) {
+	n["CMDP-"+nls+"-"+command+"-"+param+"-NAME"] = label
+}
+
+// IndexLabel sets the display name of one value of an index editor range
+// with the given NLS prefix.
+func (n NLS) IndexLabel(nls string, value int, label string) {
+	n[fmt.Sprintf("%s-%d", nls, value)] = label
+}
+
+// IndexLabels sets the display names of a sequence of index values
+// starting at zero, as a convenience for the common case of an enumeration.
+func (n NLS) IndexLabels(nls string, labels ...string) {
+	for i, label := range labels {
+		n.IndexLabel(nls, i, label)
+	}
+}
+
+// WriteTo writes the entries in the format the ISY expects, sorted by key.
+func (n NLS) WriteTo(w io.Writer) (int64, error) {
+	keys := make([]string, 0, len(n))
+	for k := range n {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Each entry must occupy exactly one line.
+	newlines := strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+	var total int64
+	for _, k := range keys {
+		c, err := fmt.Fprintf(w, "%s = %s\n", k, newlines.Replace(n[k]))
+		total += int64(c)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,41 @@
+package profile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/andreyvit/diff"
+)
+
+func TestNLSWriteTo(t *testing.T) {
+	nls := NLS{}
+	nls.NodeName("thermostat", "Thermostat")
+	nls.DriverLabel("tstat", "CLIMD", "Mode")
+	nls.CommandLabel("tstat", "SETMODE", "Set Mode")
+	nls.CommandParamLabel("tstat", "SETMODE", "MODE", "Mode")
+	nls.IndexLabels("MODE", "Off", "Heat", "Cool")
+	nls.IndexLabel("MODE", 5, "Multi\nLine")
+
+	var buf bytes.Buffer
+	n, err := nls.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("reported %d bytes written, but wrote %d", n, buf.Len())
+	}
+
+	got := buf.String()
+	want := `CMD-tstat-SETMODE-NAME = Set Mode
+CMDP-tstat-SETMODE-MODE-NAME = Mode
+MODE-0 = Off
+MODE-1 = Heat
+MODE-2 = Cool
+MODE-5 = Multi Line
+ND-thermostat-NAME = Thermostat
+ST-tstat-CLIMD-NAME = Mode
+`
+	if got != want {
+		t.Errorf("wrong result\n%s", diff.LineDiff(want, got))
+	}
+}
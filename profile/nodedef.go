@@ -0,0 +1,55 @@
+package profile
+
+// NodeDef describes a type of node that a node server provides.
+type NodeDef struct {
+	ID string `xml:"id,attr"`
+
+	// NLS is the prefix used to look up localized names for this node's
+	// drivers and commands. If empty, the ID is used.
+	NLS string `xml:"nls,attr,omitempty"`
+
+	Drivers []*DriverDef `xml:"sts>st"`
+
+	// Sends are the commands that nodes of this type may send to the ISY,
+	// such as when a device is operated locally.
+	Sends []*Command `xml:"cmds>sends>cmd"`
+
+	// Accepts are the commands that nodes of this type accept from the ISY.
+	Accepts []*Command `xml:"cmds>accepts>cmd"`
+}
+
+// DriverDef describes one of the status values ("drivers") of a node type.
+type DriverDef struct {
+	// ID is the driver name, such as "ST" for the main status.
+	ID string `xml:"id,attr"`
+
+	// Editor is the ID of the Editor describing the driver's values.
+	Editor string `xml:"editor,attr"`
+}
+
+// Command describes a command that can be sent to or from a node.
+type Command struct {
+	ID     string   `xml:"id,attr"`
+	Params []*Param `xml:"p"`
+}
+
+// Param describes a parameter of a Command.
+type Param struct {
+	// ID is the parameter name. The ID is empty for the single unnamed
+	// parameter of a command that accepts only one value.
+	ID string `xml:"id,attr"`
+
+	// Editor is the ID of the Editor describing the parameter's values.
+	Editor string `xml:"editor,attr"`
+
+	// Init optionally names a driver whose current value is used as the
+	// initial value of this parameter in the ISY's UI.
+	Init string `xml:"init,attr,omitempty"`
+
+	Optional bool `xml:"optional,attr,omitempty"`
+}
+
+type nodeDefsDoc struct {
+	XMLName  struct{}   `xml:"nodeDefs"`
+	NodeDefs []*NodeDef `xml:"nodeDef"`
+}
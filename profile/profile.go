@@ -0,0 +1,121 @@
+package profile
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Profile is a complete node server profile.
+type Profile struct {
+	NodeDefs []*NodeDef
+	Editors  []*Editor
+
+	// NLS maps keys to the English text for node, driver, command and
+	// index value names, such as "ND-thermostat-NAME" = "Thermostat".
+	NLS NLS
+}
+
+// WriteZip writes the profile to the given writer as a zip archive in the
+// layout the ISY expects. It fails without writing anything if the profile
+// is not valid; see Validate.
+func (p *Profile) WriteZip(w io.Writer) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	err = writeZipXML(zw, "nodedef/nodedefs.xml", &nodeDefsDoc{NodeDefs: p.NodeDefs})
+	if err != nil {
+		return err
+	}
+	err = writeZipXML(zw, "editor/editors.xml", &editorsDoc{Editors: p.Editors})
+	if err != nil {
+		return err
+	}
+
+	f, err := zw.Create("nls/en_us.txt")
+	if err != nil {
+		return err
+	}
+	_, err = p.NLS.WriteTo(f)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Validate checks that the profile is consistent, returning an error
+// describing all of the problems found. The ISY accepts an inconsistent
+// profile but then shows blank values or labels for the affected drivers.
+//
+// Every driver and command parameter must refer to one of the profile's
+// editors, every driver must have a label in NLS, and the IDs of generic
+// drivers must have the form GV0, GV1, and so on.
+func (p *Profile) Validate() error {
+	editors := make(map[string]bool, len(p.Editors))
+	for _, e := range p.Editors {
+		editors[e.ID] = true
+	}
+
+	var problems []string
+	for _, def := range p.NodeDefs {
+		nls := def.NLS
+		if nls == "" {
+			nls = def.ID
+		}
+
+		for _, d := range def.Drivers {
+			if strings.HasPrefix(d.ID, "GV") {
+				if n, err := strconv.Atoi(d.ID[2:]); err != nil || n < 0 {
+					problems = append(problems, fmt.Sprintf("node definition %q: invalid generic driver ID %q", def.ID, d.ID))
+				}
+			}
+			if !editors[d.Editor] {
+				problems = append(problems, fmt.Sprintf("node definition %q: driver %s uses undefined editor %q", def.ID, d.ID, d.Editor))
+			}
+			if _, ok := p.NLS["ST-"+nls+"-"+d.ID+"-NAME"]; !ok {
+				problems = append(problems, fmt.Sprintf("node definition %q: driver %s has no label; use NLS.DriverLabel", def.ID, d.ID))
+			}
+		}
+
+		cmds := append(append([]*Command(nil), def.Sends...), def.Accepts...)
+		for _, cmd := range cmds {
+			for _, param := range cmd.Params {
+				if !editors[param.Editor] {
+					problems = append(problems, fmt.Sprintf("node definition %q: parameter %q of command %s uses undefined editor %q", def.ID, param.ID, cmd.ID, param.Editor))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid profile:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func writeZipXML(zw *zip.Writer, name string, doc interface{}) error {
+	src, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to generate %s: %s", name, err)
+	}
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, xml.Header)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(src)
+	return err
+}
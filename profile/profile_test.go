@@ -0,0 +1,187 @@
+package profile
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/diff"
+	"github.com/apparentlymart/go-isy/isy"
+)
+
+func TestNodeDefsXML(t *testing.T) {
+	doc := &nodeDefsDoc{
+		NodeDefs: []*NodeDef{
+			{
+				ID:  "thermostat",
+				NLS: "tstat",
+				Drivers: []*DriverDef{
+					{ID: "ST", Editor: "TEMP"},
+					{ID: "CLISPH", Editor: "TEMP"},
+				},
+				Accepts: []*Command{
+					{
+						ID: "CLISPH",
+						Params: []*Param{
+							{Editor: "TEMP", Init: "CLISPH"},
+						},
+					},
+					{ID: "QUERY"},
+				},
+			},
+		},
+	}
+
+	got, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.TrimSpace(`
+<nodeDefs>
+  <nodeDef id="thermostat" nls="tstat">
+    <sts>
+      <st id="ST" editor="TEMP"></st>
+      <st id="CLISPH" editor="TEMP"></st>
+    </sts>
+    <cmds>
+      <sends></sends>
+      <accepts>
+        <cmd id="CLISPH">
+          <p id="" editor="TEMP" init="CLISPH"></p>
+        </cmd>
+        <cmd id="QUERY"></cmd>
+      </accepts>
+    </cmds>
+  </nodeDef>
+</nodeDefs>
+`)
+
+	if string(got) != want {
+		t.Errorf("wrong result\n%s", diff.LineDiff(want, string(got)))
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	p := &Profile{
+		Editors: []*Editor{
+			{
+				ID: "TEMP",
+				Ranges: []*Range{
+					{UOM: isy.UOMFahrenheit, Min: -40, Max: 120, Prec: 1, Step: 0.5},
+				},
+			},
+		},
+		NLS: map[string]string{
+			"ND-thermostat-NAME": "Thermostat",
+			"ND-thermostat-ICON": "Thermostat",
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	err := p.WriteZip(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+
+	if _, exists := files["nodedef/nodedefs.xml"]; !exists {
+		t.Errorf("nodedef/nodedefs.xml is missing")
+	}
+
+	wantEditors := xml.Header + strings.TrimSpace(`
+<editors>
+  <editor id="TEMP">
+    <range uom="17" min="-40" max="120" prec="1" step="0.5"></range>
+  </editor>
+</editors>
+`)
+	if got := files["editor/editors.xml"]; got != wantEditors {
+		t.Errorf("wrong editors.xml\n%s", diff.LineDiff(wantEditors, got))
+	}
+
+	wantNLS := "ND-thermostat-ICON = Thermostat\nND-thermostat-NAME = Thermostat\n"
+	if got := files["nls/en_us.txt"]; got != wantNLS {
+		t.Errorf("wrong en_us.txt\n%s", diff.LineDiff(wantNLS, got))
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	p := &Profile{
+		NodeDefs: []*NodeDef{
+			{
+				ID:  "thermostat",
+				NLS: "tstat",
+				Drivers: []*DriverDef{
+					{ID: "ST", Editor: "TEMP"},
+					{ID: "GV1", Editor: "MODE"},
+					{ID: "GVX", Editor: "TEMP"},
+				},
+				Accepts: []*Command{
+					{
+						ID: "CLISPH",
+						Params: []*Param{
+							{Editor: "SETPOINT"},
+						},
+					},
+				},
+			},
+		},
+		Editors: []*Editor{
+			{ID: "TEMP"},
+		},
+		NLS: NLS{
+			"ST-tstat-ST-NAME":  "Temperature",
+			"ST-tstat-GVX-NAME": "Broken",
+		},
+	}
+
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("Validate succeeded; want error")
+	}
+	want := strings.TrimSpace(`
+invalid profile:
+  node definition "thermostat": driver GV1 uses undefined editor "MODE"
+  node definition "thermostat": driver GV1 has no label; use NLS.DriverLabel
+  node definition "thermostat": invalid generic driver ID "GVX"
+  node definition "thermostat": parameter "" of command CLISPH uses undefined editor "SETPOINT"
+`)
+	if got := err.Error(); got != want {
+		t.Errorf("wrong error\n%s", diff.LineDiff(want, got))
+	}
+
+	p.Editors = append(p.Editors, &Editor{ID: "MODE"}, &Editor{ID: "SETPOINT"})
+	p.NLS.DriverLabel("tstat", "GV1", "Mode")
+	p.NodeDefs[0].Drivers = p.NodeDefs[0].Drivers[:2]
+	err = p.Validate()
+	if err != nil {
+		t.Errorf("unexpected error after fixing problems: %s", err)
+	}
+
+	err = p.WriteZip(&bytes.Buffer{})
+	if err != nil {
+		t.Errorf("unexpected error from WriteZip: %s", err)
+	}
+}